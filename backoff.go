@@ -0,0 +1,59 @@
+package zapi
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Backoff describes an exponential backoff strategy. The delay before attempt
+// n (starting at 0) is Initial * Multiplier^n, capped at Max, and then
+// randomized by up to ±Jitter (a fraction between 0 and 1).
+type Backoff struct {
+	Initial    time.Duration
+	Max        time.Duration
+	Multiplier float64
+	Jitter     float64
+}
+
+// DefaultBackoff is the Backoff used when one is not explicitly provided
+var DefaultBackoff = Backoff{
+	Initial:    250 * time.Millisecond,
+	Max:        10 * time.Second,
+	Multiplier: 2,
+	Jitter:     0.2,
+}
+
+// Delay returns how long to wait before the given attempt
+func (b Backoff) Delay(attempt int) time.Duration {
+	if b.Initial <= 0 {
+		return 0
+	}
+
+	mult := b.Multiplier
+	if mult < 1 {
+		mult = 1
+	}
+
+	d := float64(b.Initial)
+	for i := 0; i < attempt; i++ {
+		d *= mult
+		if b.Max > 0 && d >= float64(b.Max) {
+			break
+		}
+	}
+
+	if b.Max > 0 && d > float64(b.Max) {
+		d = float64(b.Max)
+	}
+
+	if b.Jitter > 0 {
+		// #nosec
+		d += d * b.Jitter * (2*rand.Float64() - 1)
+	}
+
+	if d < 0 {
+		return 0
+	}
+
+	return time.Duration(d)
+}
@@ -0,0 +1,358 @@
+package zapi
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/pkg/errors"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	msg "zvelo.io/msg/msgpb"
+)
+
+// DefaultMaxBatchSize is the maximum number of URLs that will be merged into a
+// single Query unless overridden with WithMaxBatchSize
+const DefaultMaxBatchSize = 100
+
+// DefaultMaxBatchDelay is the longest a Query will be held while waiting for
+// others to merge with unless overridden with WithMaxBatchDelay
+const DefaultMaxBatchDelay = 10 * time.Millisecond
+
+type batchOptions struct {
+	maxSize  int
+	maxDelay time.Duration
+}
+
+// A BatchOption configures the batching clients returned by BatchRESTv1 and
+// BatchGRPCv1
+type BatchOption func(*batchOptions)
+
+// WithMaxBatchSize returns a BatchOption that sets the number of URLs at
+// which a batch is sent immediately
+func WithMaxBatchSize(val int) BatchOption {
+	if val <= 0 {
+		val = DefaultMaxBatchSize
+	}
+
+	return func(o *batchOptions) {
+		o.maxSize = val
+	}
+}
+
+// WithMaxBatchDelay returns a BatchOption that sets how long a batch will wait
+// for more URLs before being sent
+func WithMaxBatchDelay(val time.Duration) BatchOption {
+	if val <= 0 {
+		val = DefaultMaxBatchDelay
+	}
+
+	return func(o *batchOptions) {
+		o.maxDelay = val
+	}
+}
+
+type queryFunc func(ctx context.Context, in *msg.QueryRequests) (*msg.QueryReplies, error)
+
+type batchReply struct {
+	reply *msg.QueryReply
+	err   error
+}
+
+type batch struct {
+	key     string
+	req     *msg.QueryRequests
+	waiters []chan<- batchReply
+	ctxs    []context.Context
+	timer   *time.Timer
+	gone    int
+	cancel  context.CancelFunc
+}
+
+// valuesContext carries the values of a context, e.g. its metadata, without
+// its deadline and cancellation
+type valuesContext struct {
+	context.Context
+}
+
+func (valuesContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (valuesContext) Done() <-chan struct{}       { return nil }
+func (valuesContext) Err() error                  { return nil }
+
+// context returns the context of the batched query. It has the values of the
+// first caller's context and the latest deadline of the callers, if all of
+// them have one.
+func (p *batch) context() (context.Context, context.CancelFunc) {
+	var ctx context.Context = valuesContext{p.ctxs[0]}
+
+	var latest time.Time
+	for _, c := range p.ctxs {
+		deadline, ok := c.Deadline()
+		if !ok {
+			return context.WithCancel(ctx)
+		}
+
+		if deadline.After(latest) {
+			latest = deadline
+		}
+	}
+
+	return context.WithDeadline(ctx, latest)
+}
+
+type batcher struct {
+	sync.Mutex
+	options batchOptions
+	query   queryFunc
+	pending map[string]*batch
+}
+
+func newBatcher(query queryFunc, opts ...BatchOption) *batcher {
+	b := batcher{
+		options: batchOptions{
+			maxSize:  DefaultMaxBatchSize,
+			maxDelay: DefaultMaxBatchDelay,
+		},
+		query:   query,
+		pending: map[string]*batch{},
+	}
+
+	for _, opt := range opts {
+		opt(&b.options)
+	}
+
+	return &b
+}
+
+// batchable returns whether in can be merged with other requests. Only
+// requests for a single URL that set no other field than Dataset are merged,
+// since the replies to any other payload, e.g. content or a callback, might
+// not correspond one to one with the merged URLs.
+func batchable(in *msg.QueryRequests) bool {
+	if in == nil || len(in.Url) != 1 {
+		return false
+	}
+
+	return proto.Equal(in, &msg.QueryRequests{Url: in.Url, Dataset: in.Dataset})
+}
+
+// batchKey returns a key that is identical for all batchable requests that
+// only differ by their URL and for which the outgoing metadata is the same
+func batchKey(ctx context.Context, in *msg.QueryRequests) (string, error) {
+	if !batchable(in) {
+		return "", errors.New("query can't be batched")
+	}
+
+	tpl, ok := proto.Clone(in).(*msg.QueryRequests)
+	if !ok {
+		return "", errors.New("failed to clone QueryRequests")
+	}
+
+	tpl.Url = nil
+	sort.Slice(tpl.Dataset, func(i, j int) bool { return tpl.Dataset[i] < tpl.Dataset[j] })
+
+	key, err := proto.Marshal(tpl)
+	if err != nil {
+		return "", err
+	}
+
+	if md, ok := metadata.FromOutgoingContext(ctx); ok {
+		keys := make([]string, 0, len(md))
+		for k := range md {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			key = append(key, 0)
+			key = append(key, k...)
+			for _, v := range md[k] {
+				key = append(key, 0)
+				key = append(key, v...)
+			}
+		}
+	}
+
+	return string(key), nil
+}
+
+func (b *batcher) Query(ctx context.Context, in *msg.QueryRequests) (*msg.QueryReplies, error) {
+	key, err := batchKey(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan batchReply, 1)
+
+	b.Lock()
+	p, ok := b.pending[key]
+	if !ok {
+		req, _ := proto.Clone(in).(*msg.QueryRequests)
+		req.Url = nil
+
+		p = &batch{
+			key: key,
+			req: req,
+		}
+		b.pending[key] = p
+		p.timer = time.AfterFunc(b.options.maxDelay, func() { b.flush(p) })
+	}
+
+	p.req.Url = append(p.req.Url, in.Url[0])
+	p.waiters = append(p.waiters, ch)
+	p.ctxs = append(p.ctxs, ctx)
+
+	full := len(p.req.Url) >= b.options.maxSize
+	b.Unlock()
+
+	if full {
+		// don't block this caller's cancellation on the query
+		go b.flush(p)
+	}
+
+	select {
+	case <-ctx.Done():
+		b.leave(p)
+		return nil, ctx.Err()
+	case res := <-ch:
+		if res.err != nil {
+			return nil, res.err
+		}
+		return &msg.QueryReplies{Reply: []*msg.QueryReply{res.reply}}, nil
+	}
+}
+
+func (b *batcher) flush(p *batch) {
+	b.Lock()
+	if b.pending[p.key] != p {
+		// already flushed
+		b.Unlock()
+		return
+	}
+	delete(b.pending, p.key)
+	p.timer.Stop()
+
+	if p.gone == len(p.waiters) {
+		// every caller has already given up
+		b.Unlock()
+		return
+	}
+
+	ctx, cancel := p.context()
+	p.cancel = cancel
+	b.Unlock()
+
+	defer cancel()
+
+	replies, err := b.query(ctx, p.req)
+	if err == nil && (replies == nil || len(replies.Reply) != len(p.waiters)) {
+		err = errors.New("batched query returned an unexpected number of replies")
+	}
+
+	for i, ch := range p.waiters {
+		if err != nil {
+			ch <- batchReply{err: err}
+			continue
+		}
+
+		ch <- batchReply{reply: replies.Reply[i]}
+	}
+}
+
+// leave is called when a caller stops waiting for p. The batched query is
+// canceled once every caller has left.
+func (b *batcher) leave(p *batch) {
+	b.Lock()
+	defer b.Unlock()
+
+	p.gone++
+	if p.gone == len(p.waiters) && p.cancel != nil {
+		p.cancel()
+	}
+}
+
+func (b *batcher) flushAll() {
+	b.Lock()
+	pending := make([]*batch, 0, len(b.pending))
+	for _, p := range b.pending {
+		pending = append(pending, p)
+	}
+	b.Unlock()
+
+	var wg sync.WaitGroup
+	for _, p := range pending {
+		wg.Add(1)
+		go func(p *batch) {
+			defer wg.Done()
+			b.flush(p)
+		}(p)
+	}
+	wg.Wait()
+}
+
+type restV1Batcher struct {
+	RESTv1Client
+	batcher *batcher
+}
+
+// BatchRESTv1 returns a RESTv1Client that merges concurrent single URL Query
+// calls that are otherwise identical into a single call to client. Each caller
+// receives only the QueryReply for its own URL. Calls with more than one URL,
+// with fields other than Url and Dataset or with CallOptions are passed
+// directly to client.
+func BatchRESTv1(client RESTv1Client, opts ...BatchOption) RESTv1Client {
+	return restV1Batcher{
+		RESTv1Client: client,
+		batcher: newBatcher(func(ctx context.Context, in *msg.QueryRequests) (*msg.QueryReplies, error) {
+			return client.Query(ctx, in)
+		}, opts...),
+	}
+}
+
+func (c restV1Batcher) ExecGraphQL(ctx context.Context, req *GraphQLRequest, data interface{}, opts ...CallOption) error {
+	return execGraphQL(ctx, c.RESTv1Client, req, data, opts...)
+}
+
+func (c restV1Batcher) Query(ctx context.Context, in *msg.QueryRequests, opts ...CallOption) (*msg.QueryReplies, error) {
+	if len(opts) > 0 || !batchable(in) {
+		return c.RESTv1Client.Query(ctx, in, opts...)
+	}
+
+	return c.batcher.Query(ctx, in)
+}
+
+type grpcV1Batcher struct {
+	GRPCv1Client
+	batcher *batcher
+}
+
+// BatchGRPCv1 returns a GRPCv1Client that merges concurrent single URL Query
+// calls that are otherwise identical into a single call to client. Each caller
+// receives only the QueryReply for its own URL. Calls with more than one URL,
+// with fields other than Url and Dataset or with CallOptions are passed
+// directly to client. Close sends any pending batches before closing client.
+func BatchGRPCv1(client GRPCv1Client, opts ...BatchOption) GRPCv1Client {
+	return grpcV1Batcher{
+		GRPCv1Client: client,
+		batcher: newBatcher(func(ctx context.Context, in *msg.QueryRequests) (*msg.QueryReplies, error) {
+			return client.Query(ctx, in)
+		}, opts...),
+	}
+}
+
+func (c grpcV1Batcher) Query(ctx context.Context, in *msg.QueryRequests, opts ...grpc.CallOption) (*msg.QueryReplies, error) {
+	if len(opts) > 0 || !batchable(in) {
+		return c.GRPCv1Client.Query(ctx, in, opts...)
+	}
+
+	return c.batcher.Query(ctx, in)
+}
+
+func (c grpcV1Batcher) Close() error {
+	c.batcher.flushAll()
+	return c.GRPCv1Client.Close()
+}
@@ -0,0 +1,172 @@
+package zapi
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	msg "zvelo.io/msg/msgpb"
+)
+
+type batchingClient struct {
+	RESTv1Client
+	calls int32
+}
+
+func (c *batchingClient) Query(ctx context.Context, in *msg.QueryRequests, opts ...CallOption) (*msg.QueryReplies, error) {
+	atomic.AddInt32(&c.calls, 1)
+
+	var replies msg.QueryReplies
+	for _, u := range in.Url {
+		replies.Reply = append(replies.Reply, &msg.QueryReply{RequestId: "id-" + u})
+	}
+
+	return &replies, nil
+}
+
+func TestBatch(t *testing.T) {
+	const n = 10
+
+	c := &batchingClient{}
+	client := BatchRESTv1(c, WithMaxBatchSize(n), WithMaxBatchDelay(time.Minute))
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			u := strconv.Itoa(i)
+			replies, err := client.Query(context.Background(), &msg.QueryRequests{
+				Url:     []string{u},
+				Dataset: []msg.DatasetType{msg.CATEGORIZATION},
+			})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			if len(replies.Reply) != 1 || replies.Reply[0].RequestId != "id-"+u {
+				t.Errorf("unexpected replies for %s: %v", u, replies)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if c.calls != 1 {
+		t.Errorf("expected 1 call, got %d", c.calls)
+	}
+
+	// requests with other fields are passed through
+
+	if _, err := client.Query(context.Background(), &msg.QueryRequests{
+		Url:      []string{"a"},
+		Callback: "http://example.com",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if c.calls != 2 {
+		t.Errorf("expected 2 calls, got %d", c.calls)
+	}
+
+	// a partial batch is sent after the delay
+
+	c = &batchingClient{}
+	client = BatchRESTv1(c, WithMaxBatchDelay(time.Millisecond))
+
+	replies, err := client.Query(context.Background(), &msg.QueryRequests{Url: []string{"a"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if replies.Reply[0].RequestId != "id-a" {
+		t.Errorf("unexpected reply: %v", replies.Reply[0])
+	}
+
+	// only requests for a single URL without other fields are batched
+
+	if _, err = batchKey(context.Background(), &msg.QueryRequests{}); err == nil {
+		t.Error("expected a request without a URL to be rejected")
+	}
+
+	if _, err = batchKey(context.Background(), &msg.QueryRequests{Url: []string{"a"}, Callback: "http://example.com"}); err == nil {
+		t.Error("expected a request with a callback to be rejected")
+	}
+
+	// different datasets are not merged
+
+	k0, _ := batchKey(context.Background(), &msg.QueryRequests{Url: []string{"a"}, Dataset: []msg.DatasetType{msg.ECHO, msg.CATEGORIZATION}})
+	k1, _ := batchKey(context.Background(), &msg.QueryRequests{Url: []string{"b"}, Dataset: []msg.DatasetType{msg.CATEGORIZATION, msg.ECHO}})
+	k2, _ := batchKey(context.Background(), &msg.QueryRequests{Url: []string{"a"}, Dataset: []msg.DatasetType{msg.ECHO}})
+
+	if k0 != k1 {
+		t.Error("expected requests with the same datasets to share a key")
+	}
+
+	if k0 == k2 {
+		t.Error("expected requests with different datasets to have different keys")
+	}
+}
+
+type batchKeyType struct{}
+
+func TestBatchContext(t *testing.T) {
+	type call struct {
+		deadline time.Time
+		value    interface{}
+		err      error
+	}
+
+	calls := make(chan call, 1)
+
+	b := newBatcher(func(ctx context.Context, in *msg.QueryRequests) (*msg.QueryReplies, error) {
+		// hang until the batch is canceled
+		<-ctx.Done()
+		deadline, _ := ctx.Deadline()
+		calls <- call{deadline: deadline, value: ctx.Value(batchKeyType{}), err: ctx.Err()}
+		return nil, ctx.Err()
+	}, WithMaxBatchSize(2), WithMaxBatchDelay(time.Minute))
+
+	base := context.WithValue(context.Background(), batchKeyType{}, "span")
+
+	ctx0, cancel0 := context.WithTimeout(base, 20*time.Millisecond)
+	defer cancel0()
+
+	latest := time.Now().Add(time.Hour)
+	ctx1, cancel1 := context.WithDeadline(base, latest)
+
+	errs := make(chan error, 2)
+	for _, ctx := range []context.Context{ctx0, ctx1} {
+		go func(ctx context.Context) {
+			_, err := b.Query(ctx, &msg.QueryRequests{Url: []string{"a"}})
+			errs <- err
+		}(ctx)
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if err := <-errs; err != context.DeadlineExceeded {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+
+	// the batch continues for the remaining caller
+	select {
+	case <-calls:
+		t.Fatal("batch canceled while a caller is waiting")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	cancel1()
+
+	if err := <-errs; err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+
+	c := <-calls
+	if !c.deadline.Equal(latest) || c.value != "span" || c.err != context.Canceled {
+		t.Errorf("unexpected batch context: %+v", c)
+	}
+}
@@ -0,0 +1,460 @@
+package zapi
+
+import (
+	"container/list"
+	"context"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/pkg/errors"
+
+	"google.golang.org/grpc"
+
+	msg "zvelo.io/msg/msgpb"
+)
+
+// DefaultCacheSize is the maximum number of results held by a ResultCache
+// unless overridden with WithCacheSize
+const DefaultCacheSize = 10000
+
+// DefaultCacheTTL is how long a ResultCache holds results unless overridden
+// with WithCacheTTL
+const DefaultCacheTTL = 5 * time.Minute
+
+// CacheStats contains counters describing the effectiveness of a ResultCache
+type CacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+	Size      int
+}
+
+type cacheEntry struct {
+	key     string
+	result  *msg.QueryResult
+	expires time.Time
+}
+
+type pendingEntry struct {
+	key     string
+	expires time.Time
+}
+
+// A ResultCache holds complete QueryResults keyed by their normalized URL and
+// datasets. It is safe for concurrent use and may be shared by clients
+// returned by CacheRESTv1 and CacheGRPCv1.
+//
+// A query served from the cache replies with the request id of the query that
+// stored the result. Result calls with that id are served from the cache, and
+// return a copy of the stored result, while the result is held.
+type ResultCache struct {
+	mu      sync.Mutex
+	maxSize int
+	ttl     time.Duration
+	ll      *list.List
+	byKey   map[string]*list.Element
+	byReqID map[string]*list.Element
+	pending map[string]pendingEntry
+	stats   CacheStats
+	now     func() time.Time
+}
+
+// A CacheOption configures a ResultCache
+type CacheOption func(*ResultCache)
+
+// WithCacheSize returns a CacheOption that sets the maximum number of results
+// held by the ResultCache. The least recently used result is evicted when it
+// is full.
+func WithCacheSize(val int) CacheOption {
+	if val <= 0 {
+		val = DefaultCacheSize
+	}
+
+	return func(c *ResultCache) {
+		c.maxSize = val
+	}
+}
+
+// WithCacheTTL returns a CacheOption that sets how long results are held by
+// the ResultCache
+func WithCacheTTL(val time.Duration) CacheOption {
+	if val <= 0 {
+		val = DefaultCacheTTL
+	}
+
+	return func(c *ResultCache) {
+		c.ttl = val
+	}
+}
+
+// NewResultCache returns a properly configured ResultCache
+func NewResultCache(opts ...CacheOption) *ResultCache {
+	c := ResultCache{
+		maxSize: DefaultCacheSize,
+		ttl:     DefaultCacheTTL,
+		ll:      list.New(),
+		byKey:   map[string]*list.Element{},
+		byReqID: map[string]*list.Element{},
+		pending: map[string]pendingEntry{},
+		now:     time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(&c)
+	}
+
+	return &c
+}
+
+// Stats returns a snapshot of the cache counters
+func (c *ResultCache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s := c.stats
+	s.Size = c.ll.Len()
+	return s
+}
+
+// CacheCallOption controls how a single call interacts with a ResultCache. It
+// can be passed as either a CallOption or a grpc.CallOption.
+type CacheCallOption struct {
+	grpc.EmptyCallOption
+	bypass  bool
+	refresh bool
+}
+
+func (CacheCallOption) before(*http.Request) {}
+func (CacheCallOption) after(*http.Response) {}
+
+var _ CallOption = CacheCallOption{}
+
+// NoCache returns a CacheCallOption that causes the call to neither read from
+// nor write to the cache
+func NoCache() CacheCallOption {
+	return CacheCallOption{bypass: true}
+}
+
+// RefreshCache returns a CacheCallOption that causes the call to skip reading
+// from the cache but still store any complete result it produces
+func RefreshCache() CacheCallOption {
+	return CacheCallOption{refresh: true}
+}
+
+func (o CacheCallOption) merge(opt interface{}) CacheCallOption {
+	if c, ok := opt.(CacheCallOption); ok {
+		o.bypass = o.bypass || c.bypass
+		o.refresh = o.refresh || c.refresh
+	}
+	return o
+}
+
+// normalizeURL lowercases the scheme and host, removes default ports and the
+// fragment so that equivalent URLs share a cache entry
+func normalizeURL(val string) string {
+	u, err := url.Parse(strings.TrimSpace(val))
+	if err != nil || u.Host == "" {
+		return strings.TrimSpace(val)
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	u.Fragment = ""
+
+	if port := u.Port(); (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		u.Host = u.Hostname()
+	}
+
+	if u.Path == "" {
+		u.Path = "/"
+	}
+
+	return u.String()
+}
+
+func cacheKey(rawurl string, datasets []msg.DatasetType) string {
+	ds := append([]msg.DatasetType{}, datasets...)
+	sort.Slice(ds, func(i, j int) bool { return ds[i] < ds[j] })
+
+	parts := make([]string, 0, len(ds)+1)
+	parts = append(parts, normalizeURL(rawurl))
+	for i, d := range ds {
+		if i > 0 && d == ds[i-1] {
+			continue
+		}
+		parts = append(parts, d.String())
+	}
+
+	return strings.Join(parts, "\x00")
+}
+
+// cacheable returns true if in contains nothing other than urls and datasets.
+// Other fields (e.g. a callback) change the effect of a query and so it can't
+// be served from the cache.
+func cacheable(in *msg.QueryRequests) bool {
+	if in == nil || len(in.Url) == 0 {
+		return false
+	}
+
+	tpl, ok := proto.Clone(in).(*msg.QueryRequests)
+	if !ok {
+		return false
+	}
+
+	tpl.Url = nil
+	tpl.Dataset = nil
+
+	return proto.Equal(tpl, &msg.QueryRequests{})
+}
+
+func (c *ResultCache) get(elem *list.Element) *msg.QueryResult {
+	e := elem.Value.(*cacheEntry)
+	if c.now().After(e.expires) {
+		c.remove(elem)
+		return nil
+	}
+
+	c.ll.MoveToFront(elem)
+	r, _ := proto.Clone(e.result).(*msg.QueryResult)
+	return r
+}
+
+func (c *ResultCache) remove(elem *list.Element) {
+	e := c.ll.Remove(elem).(*cacheEntry)
+	delete(c.byKey, e.key)
+	delete(c.byReqID, e.result.RequestId)
+}
+
+func (c *ResultCache) lookupKey(key string) *msg.QueryResult {
+	if elem, ok := c.byKey[key]; ok {
+		if r := c.get(elem); r != nil {
+			c.stats.Hits++
+			return r
+		}
+	}
+
+	c.stats.Misses++
+	return nil
+}
+
+func (c *ResultCache) lookupReqID(reqID string) *msg.QueryResult {
+	if elem, ok := c.byReqID[reqID]; ok {
+		if r := c.get(elem); r != nil {
+			c.stats.Hits++
+			return r
+		}
+	}
+
+	c.stats.Misses++
+	return nil
+}
+
+func (c *ResultCache) addPending(reqID, key string) {
+	now := c.now()
+
+	if len(c.pending) >= c.maxSize {
+		for id, p := range c.pending {
+			if now.After(p.expires) {
+				delete(c.pending, id)
+			}
+		}
+	}
+
+	c.pending[reqID] = pendingEntry{key: key, expires: now.Add(c.ttl)}
+}
+
+func (c *ResultCache) store(result *msg.QueryResult) {
+	p, ok := c.pending[result.RequestId]
+	if !ok {
+		return
+	}
+	delete(c.pending, result.RequestId)
+
+	if elem, ok := c.byKey[p.key]; ok {
+		c.remove(elem)
+	}
+
+	if elem, ok := c.byReqID[result.RequestId]; ok {
+		c.remove(elem)
+	}
+
+	r, _ := proto.Clone(result).(*msg.QueryResult)
+	elem := c.ll.PushFront(&cacheEntry{
+		key:     p.key,
+		result:  r,
+		expires: c.now().Add(c.ttl),
+	})
+	c.byKey[p.key] = elem
+	c.byReqID[result.RequestId] = elem
+
+	for c.ll.Len() > c.maxSize {
+		c.remove(c.ll.Back())
+		c.stats.Evictions++
+	}
+}
+
+func (c *ResultCache) query(in *msg.QueryRequests, ctrl CacheCallOption, fn func(*msg.QueryRequests) (*msg.QueryReplies, error)) (*msg.QueryReplies, error) {
+	if ctrl.bypass || !cacheable(in) {
+		return fn(in)
+	}
+
+	keys := make([]string, len(in.Url))
+	replies := make([]*msg.QueryReply, len(in.Url))
+	var missIdx []int
+
+	c.mu.Lock()
+	for i, u := range in.Url {
+		keys[i] = cacheKey(u, in.Dataset)
+
+		if !ctrl.refresh {
+			if r := c.lookupKey(keys[i]); r != nil {
+				// reply with the id the result is stored under so Result hits too
+				replies[i] = &msg.QueryReply{RequestId: r.RequestId}
+				continue
+			}
+		}
+
+		missIdx = append(missIdx, i)
+	}
+	c.mu.Unlock()
+
+	if len(missIdx) == 0 {
+		return &msg.QueryReplies{Reply: replies}, nil
+	}
+
+	req, _ := proto.Clone(in).(*msg.QueryRequests)
+	req.Url = make([]string, len(missIdx))
+	for i, idx := range missIdx {
+		req.Url[i] = in.Url[idx]
+	}
+
+	resp, err := fn(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(resp.Reply) != len(missIdx) {
+		return nil, errors.New("query returned an unexpected number of replies")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i, idx := range missIdx {
+		reply := resp.Reply[i]
+		replies[idx] = reply
+
+		if reply != nil && reply.RequestId != "" {
+			c.addPending(reply.RequestId, keys[idx])
+		}
+	}
+
+	return &msg.QueryReplies{Reply: replies}, nil
+}
+
+func (c *ResultCache) result(reqID string, ctrl CacheCallOption, fn func() (*msg.QueryResult, error)) (*msg.QueryResult, error) {
+	if !ctrl.bypass && !ctrl.refresh {
+		c.mu.Lock()
+		r := c.lookupReqID(reqID)
+		c.mu.Unlock()
+
+		if r != nil {
+			return r, nil
+		}
+	}
+
+	result, err := fn()
+	if err != nil || ctrl.bypass || !IsComplete(result) {
+		return result, err
+	}
+
+	c.mu.Lock()
+	c.store(result)
+	c.mu.Unlock()
+
+	return result, nil
+}
+
+type restV1Cache struct {
+	RESTv1Client
+	cache *ResultCache
+}
+
+// CacheRESTv1 returns a RESTv1Client that serves Query and Result from cache
+// when possible. Only complete results are cached. Use NoCache and
+// RefreshCache to control caching per call.
+func CacheRESTv1(client RESTv1Client, cache *ResultCache) RESTv1Client {
+	return restV1Cache{
+		RESTv1Client: client,
+		cache:        cache,
+	}
+}
+
+func restCacheControl(opts []CallOption) CacheCallOption {
+	var ret CacheCallOption
+	for _, opt := range opts {
+		ret = ret.merge(opt)
+	}
+	return ret
+}
+
+func (c restV1Cache) Query(ctx context.Context, in *msg.QueryRequests, opts ...CallOption) (*msg.QueryReplies, error) {
+	return c.cache.query(in, restCacheControl(opts), func(req *msg.QueryRequests) (*msg.QueryReplies, error) {
+		return c.RESTv1Client.Query(ctx, req, opts...)
+	})
+}
+
+func (c restV1Cache) ExecGraphQL(ctx context.Context, req *GraphQLRequest, data interface{}, opts ...CallOption) error {
+	return execGraphQL(ctx, c.RESTv1Client, req, data, opts...)
+}
+
+func (c restV1Cache) Result(ctx context.Context, reqID string, opts ...CallOption) (*msg.QueryResult, error) {
+	return c.cache.result(reqID, restCacheControl(opts), func() (*msg.QueryResult, error) {
+		return c.RESTv1Client.Result(ctx, reqID, opts...)
+	})
+}
+
+type grpcV1Cache struct {
+	GRPCv1Client
+	cache *ResultCache
+}
+
+// CacheGRPCv1 returns a GRPCv1Client that serves Query and Result from cache
+// when possible. Only complete results are cached. Use NoCache and
+// RefreshCache to control caching per call.
+func CacheGRPCv1(client GRPCv1Client, cache *ResultCache) GRPCv1Client {
+	return grpcV1Cache{
+		GRPCv1Client: client,
+		cache:        cache,
+	}
+}
+
+func grpcCacheControl(opts []grpc.CallOption) CacheCallOption {
+	var ret CacheCallOption
+	for _, opt := range opts {
+		ret = ret.merge(opt)
+	}
+	return ret
+}
+
+func (c grpcV1Cache) Query(ctx context.Context, in *msg.QueryRequests, opts ...grpc.CallOption) (*msg.QueryReplies, error) {
+	return c.cache.query(in, grpcCacheControl(opts), func(req *msg.QueryRequests) (*msg.QueryReplies, error) {
+		return c.GRPCv1Client.Query(ctx, req, opts...)
+	})
+}
+
+func (c grpcV1Cache) Result(ctx context.Context, in *msg.RequestID, opts ...grpc.CallOption) (*msg.QueryResult, error) {
+	var reqID string
+	if in != nil {
+		reqID = in.RequestId
+	}
+
+	return c.cache.result(reqID, grpcCacheControl(opts), func() (*msg.QueryResult, error) {
+		return c.GRPCv1Client.Result(ctx, in, opts...)
+	})
+}
@@ -0,0 +1,168 @@
+package zapi
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	msg "zvelo.io/msg/msgpb"
+)
+
+type cachingClient struct {
+	RESTv1Client
+	queries int
+	results int
+}
+
+func (c *cachingClient) Query(ctx context.Context, in *msg.QueryRequests, opts ...CallOption) (*msg.QueryReplies, error) {
+	c.queries++
+
+	var replies msg.QueryReplies
+	for _, u := range in.Url {
+		replies.Reply = append(replies.Reply, &msg.QueryReply{RequestId: u})
+	}
+
+	return &replies, nil
+}
+
+func (c *cachingClient) Result(ctx context.Context, reqID string, opts ...CallOption) (*msg.QueryResult, error) {
+	c.results++
+
+	return &msg.QueryResult{
+		RequestId:   reqID,
+		QueryStatus: &msg.QueryStatus{Complete: true},
+	}, nil
+}
+
+func TestCache(t *testing.T) {
+	ctx := context.Background()
+
+	now := time.Now()
+	cache := NewResultCache(WithCacheSize(2), WithCacheTTL(time.Minute))
+	cache.now = func() time.Time { return now }
+
+	c := &cachingClient{}
+	client := CacheRESTv1(c, cache)
+
+	query := func(u string, opts ...CallOption) string {
+		t.Helper()
+
+		replies, err := client.Query(ctx, &msg.QueryRequests{
+			Url:     []string{u},
+			Dataset: []msg.DatasetType{msg.ECHO, msg.CATEGORIZATION},
+		}, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		reqID := replies.Reply[0].RequestId
+		if _, err = client.Result(ctx, reqID, opts...); err != nil {
+			t.Fatal(err)
+		}
+
+		return reqID
+	}
+
+	id0 := query("http://Example.com:80")
+
+	// equivalent url is served from the cache
+	if id := query("http://example.com/#frag"); id != id0 {
+		t.Errorf("expected cached request id %q, got %q", id0, id)
+	}
+
+	if c.queries != 1 || c.results != 1 {
+		t.Errorf("expected 1 query and 1 result, got %d and %d", c.queries, c.results)
+	}
+
+	// NoCache and RefreshCache skip the cache
+	query("http://example.com", NoCache())
+	query("http://example.com", RefreshCache())
+
+	if c.queries != 3 {
+		t.Errorf("expected 3 queries, got %d", c.queries)
+	}
+
+	// LRU eviction
+	query("http://a.com")
+	query("http://b.com")
+
+	if s := cache.Stats(); s.Evictions != 1 || s.Size != 2 {
+		t.Errorf("unexpected stats: %+v", s)
+	}
+
+	// TTL expiration
+	now = now.Add(2 * time.Minute)
+	n := c.queries
+	query("http://b.com")
+
+	if c.queries != n+1 {
+		t.Error("expected expired result to be fetched again")
+	}
+
+	if s := cache.Stats(); s.Hits != 2 || s.Misses != 8 {
+		t.Errorf("unexpected stats: %+v", s)
+	}
+}
+
+// uniqueIDClient returns a new request id for every query
+type uniqueIDClient struct {
+	cachingClient
+}
+
+func (c *uniqueIDClient) Query(ctx context.Context, in *msg.QueryRequests, opts ...CallOption) (*msg.QueryReplies, error) {
+	c.queries++
+
+	var replies msg.QueryReplies
+	for _, u := range in.Url {
+		replies.Reply = append(replies.Reply, &msg.QueryReply{
+			RequestId: fmt.Sprintf("%s-%d", u, c.queries),
+		})
+	}
+
+	return &replies, nil
+}
+
+func TestCacheHitRequestID(t *testing.T) {
+	ctx := context.Background()
+
+	c := &uniqueIDClient{}
+	client := CacheRESTv1(c, NewResultCache())
+
+	in := &msg.QueryRequests{Url: []string{"http://example.com"}}
+
+	replies, err := client.Query(ctx, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id0 := replies.Reply[0].RequestId
+
+	result, err := client.Result(ctx, id0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the result returned is a copy of the cached one
+	result.RequestId = "changed"
+
+	if replies, err = client.Query(ctx, in); err != nil {
+		t.Fatal(err)
+	}
+
+	if id := replies.Reply[0].RequestId; id != id0 {
+		t.Errorf("expected original request id %q, got %q", id0, id)
+	}
+
+	if result, err = client.Result(ctx, id0); err != nil {
+		t.Fatal(err)
+	}
+
+	if result.RequestId != id0 {
+		t.Errorf("expected result for %q, got %q", id0, result.RequestId)
+	}
+
+	if c.queries != 1 || c.results != 1 {
+		t.Errorf("expected 1 query and 1 result, got %d and %d", c.queries, c.results)
+	}
+}
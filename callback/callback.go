@@ -5,10 +5,15 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
+	"time"
 
 	"github.com/gogo/protobuf/jsonpb"
+	"github.com/pkg/errors"
 
 	"zvelo.io/go-zapi/internal/zvelo"
+	"zvelo.io/go-zapi/logger"
+	"zvelo.io/go-zapi/metrics"
+	"zvelo.io/go-zapi/tracing"
 	"zvelo.io/httpsig"
 	msg "zvelo.io/msg/msgpb"
 )
@@ -50,10 +55,67 @@ func drainBody(r *http.Request) (io.Reader, error) {
 	return &buf, nil
 }
 
+type options struct {
+	observer      metrics.Observer
+	tracer        tracing.Tracer
+	redactHeaders []string
+	redactFields  []string
+	noRedact      bool
+}
+
+// An Option configures Middleware
+type Option func(*options)
+
+// WithObserver returns an Option that causes every callback to be reported to
+// val once it has been handled
+func WithObserver(val metrics.Observer) Option {
+	return func(o *options) {
+		o.observer = val
+	}
+}
+
+// WithTracer returns an Option that causes a server span to be started with
+// val for every callback. The span is a child of the span propagated by the
+// traceparent header, if any, and records the request ID of the result.
+func WithTracer(val tracing.Tracer) Option {
+	return func(o *options) {
+		o.tracer = val
+	}
+}
+
+// WithRedaction returns an Option that redacts the values of the headers and
+// the URL query, form and JSON fields from request dumps in addition to
+// logger.DefaultRedactHeaders and logger.DefaultRedactFields
+func WithRedaction(headers, fields []string) Option {
+	return func(o *options) {
+		o.redactHeaders = append(o.redactHeaders, headers...)
+		o.redactFields = append(o.redactFields, fields...)
+	}
+}
+
+// WithoutRedaction returns an Option that disables the redaction of secrets,
+// e.g. the Authorization header, from request dumps
+func WithoutRedaction() Option {
+	return func(o *options) {
+		o.noRedact = true
+	}
+}
+
 // Middleware returns an http.Handler that can be used with an http.Server
 // to receive and process zveloAPI callbacks. If getter is not nil, it will be
-// used to validate HTTP Signatures on the incoming request.
-func Middleware(getter httpsig.KeyGetter, h Handler, debug io.Writer) http.Handler {
+// used to validate HTTP Signatures on the incoming request. If debug is not
+// nil, incoming requests are dumped to it.
+func Middleware(getter httpsig.KeyGetter, h Handler, debug io.Writer, opts ...Option) http.Handler {
+	return MiddlewareWithLogger(getter, h, logger.Color(debug), opts...)
+}
+
+// MiddlewareWithLogger is like Middleware but logs incoming requests to l
+func MiddlewareWithLogger(getter httpsig.KeyGetter, h Handler, l logger.Logger, opts ...Option) http.Handler {
+	o := options{observer: metrics.Discard}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
 	var handler http.Handler
 
 	handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -74,6 +136,8 @@ func Middleware(getter httpsig.KeyGetter, h Handler, debug io.Writer) http.Handl
 			return
 		}
 
+		tracing.SpanFromContext(r.Context()).SetAttribute(tracing.AttrRequestID, result.RequestId)
+
 		h.Handle(w, r, &result)
 	})
 
@@ -81,5 +145,109 @@ func Middleware(getter httpsig.KeyGetter, h Handler, debug io.Writer) http.Handl
 		handler = httpsig.Middleware(httpsig.SignatureHeader, getter, handler)
 	}
 
-	return zvelo.DebugHandler(debug, handler)
+	if l == nil {
+		l = logger.Discard
+	}
+
+	if !o.noRedact {
+		l = logger.RedactDefaults(l, o.redactHeaders, o.redactFields)
+	}
+
+	handler = zvelo.DebugHandler(l, handler)
+
+	if o.tracer != nil {
+		handler = trace(o.tracer, handler)
+	}
+
+	return observe(o.observer, handler)
+}
+
+// trace starts a server span for each request handled by next
+func trace(t tracing.Tracer, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if sc, ok := tracing.Extract(r.Header); ok {
+			ctx = tracing.ContextWithRemoteParent(ctx, sc)
+		}
+
+		ctx, span := tracing.Start(ctx, t, "zapi.Callback", tracing.Server)
+
+		rw := responseWriter{ResponseWriter: w}
+		next.ServeHTTP(&rw, r.WithContext(ctx))
+
+		var err error
+		if rw.status >= http.StatusBadRequest {
+			err = errors.New(http.StatusText(rw.status))
+		}
+
+		span.End(err)
+	})
+}
+
+// observe reports each request handled by next to o
+func observe(o metrics.Observer, next http.Handler) http.Handler {
+	if o == nil || o == metrics.Discard {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		rw := responseWriter{ResponseWriter: w}
+		body := countingBody{ReadCloser: r.Body}
+		if r.Body != nil && r.Body != http.NoBody {
+			r.Body = &body
+		}
+
+		next.ServeHTTP(&rw, r)
+
+		if rw.status == 0 {
+			rw.status = http.StatusOK
+		}
+
+		o.Observe(metrics.Observation{
+			Method:        "Callback",
+			Transport:     metrics.Callback,
+			Code:          metrics.HTTPCode(rw.status),
+			HTTPStatus:    rw.status,
+			Duration:      time.Since(start),
+			BytesSent:     rw.n,
+			BytesReceived: body.n,
+		})
+	})
+}
+
+// responseWriter records the status code and number of bytes written
+type responseWriter struct {
+	http.ResponseWriter
+	status int
+	n      int64
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// countingBody counts the bytes read from a request body
+type countingBody struct {
+	io.ReadCloser
+	n int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	return n, err
 }
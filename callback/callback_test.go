@@ -18,8 +18,11 @@ import (
 
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/clientcredentials"
+	"google.golang.org/grpc/codes"
 
 	"zvelo.io/go-zapi/internal/zvelo"
+	"zvelo.io/go-zapi/metrics"
+	"zvelo.io/go-zapi/tracing"
 	"zvelo.io/httpsig"
 	msg "zvelo.io/msg/msgpb"
 )
@@ -126,3 +129,81 @@ func TestCallbackHandler(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestObserver(t *testing.T) {
+	var got []metrics.Observation
+	o := metrics.ObserverFunc(func(val metrics.Observation) { got = append(got, val) })
+
+	var result *msg.QueryResult
+	h := Middleware(nil, handler(&result), nil, WithObserver(o))
+
+	body := `{"requestId":"abc"}`
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/", bytes.NewBufferString(body)))
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/", nil))
+
+	if result == nil || result.RequestId != "abc" {
+		t.Errorf("unexpected result: %v", result)
+	}
+
+	if len(got) != 2 {
+		t.Fatalf("expected 2 observations, got %d", len(got))
+	}
+
+	if got[0].Method != "Callback" || got[0].Transport != metrics.Callback || got[0].Code != codes.OK ||
+		got[0].BytesReceived != int64(len(body)) {
+		t.Errorf("unexpected observation: %+v", got[0])
+	}
+
+	if got[1].HTTPStatus != http.StatusBadRequest || got[1].Code != codes.InvalidArgument || got[1].BytesSent == 0 {
+		t.Errorf("unexpected observation: %+v", got[1])
+	}
+}
+
+type testSpan struct {
+	parent tracing.SpanContext
+	attrs  map[string]interface{}
+	err    error
+}
+
+func (s *testSpan) SpanContext() tracing.SpanContext         { return tracing.SpanContext{} }
+func (s *testSpan) SetAttribute(key string, val interface{}) { s.attrs[key] = val }
+func (s *testSpan) End(err error)                            { s.err = err }
+
+type testTracer []*testSpan
+
+func (t *testTracer) Start(ctx context.Context, _ string, _ tracing.SpanKind) (context.Context, tracing.Span) {
+	s := testSpan{attrs: map[string]interface{}{}}
+	s.parent, _ = tracing.RemoteParent(ctx)
+	*t = append(*t, &s)
+	return ctx, &s
+}
+
+func TestTracer(t *testing.T) {
+	var tracer testTracer
+
+	var result *msg.QueryResult
+	h := Middleware(nil, handler(&result), nil, WithTracer(&tracer))
+
+	const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	r := httptest.NewRequest("POST", "/", bytes.NewBufferString(`{"requestId":"abc"}`))
+	r.Header.Set("traceparent", traceparent)
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/", nil))
+
+	if len(tracer) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(tracer))
+	}
+
+	if span := tracer[0]; span.parent.TraceParent() != traceparent || span.attrs[tracing.AttrRequestID] != "abc" || span.err != nil {
+		t.Errorf("unexpected span: %+v", span)
+	}
+
+	if span := tracer[1]; span.parent.IsValid() || span.err == nil {
+		t.Errorf("unexpected span: %+v", span)
+	}
+}
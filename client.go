@@ -0,0 +1,155 @@
+package zapi
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"golang.org/x/oauth2"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	msg "zvelo.io/msg/msgpb"
+)
+
+// StreamClient provides an interface to receive streamed query results from
+// zveloAPI servers regardless of the transport. Both RESTv1StreamClient and
+// msg.APIv1_StreamClient implement it.
+type StreamClient interface {
+	Recv() (*msg.QueryResult, error)
+}
+
+// A Client is a transport agnostic zveloAPI client. Use FromRESTv1 or
+// FromGRPCv1 to adapt an existing client, or NewClient to create one.
+//
+// CallOptions are passed to the GRPCv1Client as follows: headers added by
+// CallOptions (e.g. WithHeader) are sent as outgoing metadata, CallOptions
+// that are also grpc.CallOptions (e.g. NoCache) are passed through and any
+// others (e.g. Response) are ignored.
+type Client interface {
+	Query(ctx context.Context, in *msg.QueryRequests, opts ...CallOption) (*msg.QueryReplies, error)
+	Result(ctx context.Context, reqID string, opts ...CallOption) (*msg.QueryResult, error)
+	Suggest(ctx context.Context, in *msg.Suggestion, opts ...CallOption) error
+	Stream(ctx context.Context) (StreamClient, error)
+	io.Closer
+}
+
+// Protocol identifies the transport used by a Client
+type Protocol string
+
+// Protocols supported by NewClient
+const (
+	ProtocolGRPC Protocol = "grpc"
+	ProtocolREST Protocol = "rest"
+)
+
+// NewClient returns a Client that uses the given protocol. opts are used to
+// configure the underlying RESTv1Client or GRPCv1Dialer.
+func NewClient(ctx context.Context, ts oauth2.TokenSource, p Protocol, opts ...Option) (Client, error) {
+	switch p {
+	case ProtocolREST:
+		return FromRESTv1(NewRESTv1(ts, opts...)), nil
+	case ProtocolGRPC:
+		c, err := NewGRPCv1(ts, opts...).Dial(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return FromGRPCv1(c), nil
+	}
+
+	return nil, errors.Errorf("unsupported protocol: %q", p)
+}
+
+type restV1Adapter struct {
+	client RESTv1Client
+}
+
+// FromRESTv1 returns a Client that uses c. Closing the Client closes c if it
+// implements io.Closer.
+func FromRESTv1(c RESTv1Client) Client {
+	return restV1Adapter{client: c}
+}
+
+func (a restV1Adapter) Query(ctx context.Context, in *msg.QueryRequests, opts ...CallOption) (*msg.QueryReplies, error) {
+	return a.client.Query(ctx, in, opts...)
+}
+
+func (a restV1Adapter) Result(ctx context.Context, reqID string, opts ...CallOption) (*msg.QueryResult, error) {
+	return a.client.Result(ctx, reqID, opts...)
+}
+
+func (a restV1Adapter) Suggest(ctx context.Context, in *msg.Suggestion, opts ...CallOption) error {
+	return a.client.Suggest(ctx, in, opts...)
+}
+
+func (a restV1Adapter) Stream(ctx context.Context) (StreamClient, error) {
+	return a.client.Stream(ctx)
+}
+
+func (a restV1Adapter) Close() error {
+	if c, ok := a.client.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+type grpcV1Adapter struct {
+	client GRPCv1Client
+}
+
+// FromGRPCv1 returns a Client that uses c. Closing the Client closes c.
+func FromGRPCv1(c GRPCv1Client) Client {
+	return grpcV1Adapter{client: c}
+}
+
+// grpcCallOptions converts CallOptions for use with a GRPCv1Client
+func grpcCallOptions(ctx context.Context, opts []CallOption) (context.Context, []grpc.CallOption) {
+	var grpcOpts []grpc.CallOption
+
+	req := http.Request{Header: http.Header{}}
+
+	for _, opt := range opts {
+		if o, ok := opt.(grpc.CallOption); ok {
+			grpcOpts = append(grpcOpts, o)
+			continue
+		}
+
+		opt.before(&req)
+	}
+
+	for k, vs := range req.Header {
+		for _, v := range vs {
+			ctx = metadata.AppendToOutgoingContext(ctx, strings.ToLower(k), v)
+		}
+	}
+
+	return ctx, grpcOpts
+}
+
+func (a grpcV1Adapter) Query(ctx context.Context, in *msg.QueryRequests, opts ...CallOption) (*msg.QueryReplies, error) {
+	ctx, grpcOpts := grpcCallOptions(ctx, opts)
+	return a.client.Query(ctx, in, grpcOpts...)
+}
+
+func (a grpcV1Adapter) Result(ctx context.Context, reqID string, opts ...CallOption) (*msg.QueryResult, error) {
+	ctx, grpcOpts := grpcCallOptions(ctx, opts)
+	return a.client.Result(ctx, &msg.RequestID{RequestId: reqID}, grpcOpts...)
+}
+
+func (a grpcV1Adapter) Suggest(ctx context.Context, in *msg.Suggestion, opts ...CallOption) error {
+	ctx, grpcOpts := grpcCallOptions(ctx, opts)
+	_, err := a.client.Suggest(ctx, in, grpcOpts...)
+	return err
+}
+
+func (a grpcV1Adapter) Stream(ctx context.Context) (StreamClient, error) {
+	return a.client.Stream(ctx, nil)
+}
+
+func (a grpcV1Adapter) Close() error {
+	return a.client.Close()
+}
@@ -0,0 +1,56 @@
+package zapi
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	msg "zvelo.io/msg/msgpb"
+)
+
+type metadataClient struct {
+	GRPCv1Client
+	md   metadata.MD
+	opts []grpc.CallOption
+}
+
+func (c *metadataClient) Result(ctx context.Context, in *msg.RequestID, opts ...grpc.CallOption) (*msg.QueryResult, error) {
+	c.md, _ = metadata.FromOutgoingContext(ctx)
+	c.opts = opts
+	return &msg.QueryResult{RequestId: in.RequestId}, nil
+}
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+
+	if _, err := NewClient(ctx, nil, Protocol("carrier pigeon")); err == nil {
+		t.Error("expected error for unsupported protocol")
+	}
+
+	c := &metadataClient{}
+	client := FromGRPCv1(c)
+
+	result, err := client.Result(ctx, "abc", WithHeader("X-Foo", "bar"), NoCache())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.RequestId != "abc" {
+		t.Errorf("unexpected request_id: %s", result.RequestId)
+	}
+
+	if v := c.md.Get("x-foo"); len(v) != 1 || v[0] != "bar" {
+		t.Errorf("expected x-foo metadata, got: %v", c.md)
+	}
+
+	if len(c.opts) != 1 {
+		t.Errorf("expected NoCache to be passed through, got: %v", c.opts)
+	}
+
+	// Client can be used with WaitForResult
+	if _, err = WaitForResult(ctx, FromRESTv1(&pollingClient{complete: 1}), "abc"); err != nil {
+		t.Fatal(err)
+	}
+}
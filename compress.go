@@ -0,0 +1,179 @@
+package zapi
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/stats"
+
+	"zvelo.io/go-zapi/internal/zvelo"
+	"zvelo.io/go-zapi/logger"
+)
+
+// compress gzips the body of req if it is at least compressMin bytes
+func (t *transport) compress(req *http.Request) error {
+	if t.compressMin <= 0 || req.Body == nil || req.Body == http.NoBody ||
+		req.ContentLength < t.compressMin || req.Header.Get("Content-Encoding") != "" {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+
+	n, err := io.Copy(zw, req.Body)
+	_ = req.Body.Close() // #nosec
+	if err != nil {
+		return err
+	}
+
+	if err = zw.Close(); err != nil {
+		return err
+	}
+
+	data := buf.Bytes()
+
+	req.Body = ioutil.NopCloser(bytes.NewReader(data))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(data)), nil
+	}
+	req.ContentLength = int64(len(data))
+	req.Header.Set("Content-Encoding", "gzip")
+
+	zvelo.DebugSize(t.log, "Request Body", n, int64(len(data)))
+
+	return nil
+}
+
+// acceptGzip requests a gzip encoded response for req the same way an
+// http.Transport would. Since the header is then set by the caller, the
+// http.Transport leaves the body compressed and decompress can log its
+// compressed size.
+func (t *transport) acceptGzip(req *http.Request) {
+	if req.Header.Get("Accept-Encoding") != "" || req.Header.Get("Range") != "" ||
+		req.Method == http.MethodHead {
+		return
+	}
+
+	if ht, ok := t.transport.(*http.Transport); !ok || ht.DisableCompression {
+		return
+	}
+
+	req.Header.Set("Accept-Encoding", "gzip")
+}
+
+// decompress transparently decompresses gzip encoded responses that weren't
+// already handled by the underlying http.RoundTripper
+func (t *transport) decompress(res *http.Response) {
+	if res.Uncompressed || !strings.EqualFold(res.Header.Get("Content-Encoding"), "gzip") {
+		return
+	}
+
+	res.Body = &gzipReader{
+		body: res.Body,
+		raw:  &countingReader{Reader: res.Body},
+		log:  t.log,
+	}
+	res.Header.Del("Content-Encoding")
+	res.Header.Del("Content-Length")
+	res.ContentLength = -1
+	res.Uncompressed = true
+}
+
+type countingReader struct {
+	io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// gzipReader lazily creates the gzip.Reader so that creating it doesn't block
+// on streams that haven't sent any data yet
+type gzipReader struct {
+	body   io.ReadCloser
+	raw    *countingReader
+	zr     *gzip.Reader
+	n      int64
+	log    logger.Logger
+	logged bool
+}
+
+func (r *gzipReader) Read(p []byte) (int, error) {
+	if r.zr == nil {
+		zr, err := gzip.NewReader(r.raw)
+		if err != nil {
+			return 0, err
+		}
+		r.zr = zr
+	}
+
+	n, err := r.zr.Read(p)
+	r.n += int64(n)
+
+	if err == io.EOF && !r.logged {
+		r.logged = true
+		zvelo.DebugSize(r.log, "Response Body", r.n, r.raw.n)
+	}
+
+	return n, err
+}
+
+func (r *gzipReader) Close() error {
+	return r.body.Close()
+}
+
+// CompressorCallOption sets the compressor used for messages sent by a single
+// gRPC call. It can be passed as either a CallOption or a grpc.CallOption.
+// It has no effect on the RESTv1Client.
+type CompressorCallOption struct {
+	grpc.CallOption
+}
+
+func (CompressorCallOption) before(*http.Request) {}
+func (CompressorCallOption) after(*http.Response) {}
+
+var _ CallOption = CompressorCallOption{}
+
+// UseCompressor returns a CompressorCallOption that overrides the compressor
+// set with WithGRPCCompressor for a single call. "identity" disables
+// compression.
+func UseCompressor(name string) CompressorCallOption {
+	return CompressorCallOption{CallOption: grpc.UseCompressor(name)}
+}
+
+// grpcFrameHeaderLen is the length of the gRPC message framing included in
+// stats.InPayload and stats.OutPayload WireLength
+const grpcFrameHeaderLen = 5
+
+// debugStatsHandler logs the size of every gRPC message sent and received
+type debugStatsHandler struct {
+	log logger.Logger
+}
+
+func (h debugStatsHandler) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+func (h debugStatsHandler) HandleRPC(_ context.Context, s stats.RPCStats) {
+	switch p := s.(type) {
+	case *stats.OutPayload:
+		zvelo.DebugMessageSize(h.log, "Request Message", int64(p.Length), int64(p.WireLength-grpcFrameHeaderLen))
+	case *stats.InPayload:
+		zvelo.DebugMessageSize(h.log, "Response Message", int64(p.Length), int64(p.WireLength-grpcFrameHeaderLen))
+	}
+}
+
+func (h debugStatsHandler) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (h debugStatsHandler) HandleConn(context.Context, stats.ConnStats) {}
@@ -0,0 +1,187 @@
+package zapi
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/stats"
+
+	msg "zvelo.io/msg/msgpb"
+)
+
+func TestCompression(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Encoding") != "gzip" {
+			http.Error(w, "expected gzip request", http.StatusBadRequest)
+			return
+		}
+
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if _, err = ioutil.ReadAll(zr); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			_, _ = w.Write([]byte(`{"reply":[{"request_id":"abc"}]}`))
+			return
+		}
+
+		w.Header().Set("Content-Encoding", "gzip")
+		zw := gzip.NewWriter(w)
+		_, _ = zw.Write([]byte(`{"reply":[{"request_id":"abc"}]}`))
+		_ = zw.Close()
+	}))
+	defer srv.Close()
+
+	var debug bytes.Buffer
+
+	client := NewRESTv1(nil,
+		WithRestBaseURL(srv.URL),
+		WithRequestCompression(100),
+		WithDebug(&debug),
+	)
+
+	in := msg.QueryRequests{Url: []string{strings.Repeat("a", 1000)}}
+
+	replies, err := client.Query(context.Background(), &in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(replies.Reply) != 1 || replies.Reply[0].RequestId != "abc" {
+		t.Errorf("unexpected replies: %v", replies)
+	}
+
+	for _, s := range []string{"* Request Body: ", "* Response Body: "} {
+		if !strings.Contains(debug.String(), s) {
+			t.Errorf("debug output missing %q", s)
+		}
+	}
+}
+
+type errReader struct{}
+
+func (errReader) Read([]byte) (int, error) {
+	return 0, errors.New("read error")
+}
+
+func TestCompressionError(t *testing.T) {
+	observer, ch := observations()
+
+	client := NewRESTv1(nil,
+		WithRequestCompression(1),
+		WithObserver(observer),
+	)
+
+	req, err := http.NewRequest("POST", "https://example.com", ioutil.NopCloser(errReader{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.ContentLength = 10
+
+	rt := client.(*restV1Client).client.Transport
+	if _, err = rt.RoundTrip(req); err == nil {
+		t.Fatal("expected error")
+	}
+
+	select {
+	case o := <-ch:
+		if o.Code == codes.OK {
+			t.Errorf("unexpected observation: %+v", o)
+		}
+	default:
+		t.Error("expected the error to be observed")
+	}
+}
+
+// payloadSizes receives the wire length of each message received by a server
+type payloadSizes chan int
+
+func (p payloadSizes) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context   { return ctx }
+func (p payloadSizes) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context { return ctx }
+func (p payloadSizes) HandleConn(context.Context, stats.ConnStats)                       {}
+
+func (p payloadSizes) HandleRPC(_ context.Context, s stats.RPCStats) {
+	if in, ok := s.(*stats.InPayload); ok {
+		p <- in.WireLength
+	}
+}
+
+func TestGRPCCompression(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wire := make(payloadSizes, 2)
+
+	srv := grpc.NewServer(grpc.StatsHandler(wire), grpc.UnknownServiceHandler(func(_ interface{}, stream grpc.ServerStream) error {
+		var in msg.RequestID
+		if err := stream.RecvMsg(&in); err != nil {
+			return err
+		}
+
+		return stream.SendMsg(&msg.QueryResult{RequestId: in.RequestId})
+	}))
+	go func() { _ = srv.Serve(lis) }()
+	defer srv.Stop()
+
+	var debug bytes.Buffer
+
+	ctx := context.Background()
+	client, err := NewGRPCv1(nil,
+		WithoutTLS(),
+		WithGrpcTarget(lis.Addr().String()),
+		WithGRPCCompressor("gzip"),
+		WithDebug(&debug),
+	).Dial(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close() // #nosec
+
+	in := msg.RequestID{RequestId: strings.Repeat("a", 1000)}
+
+	result, err := client.Result(ctx, &in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.RequestId != in.RequestId {
+		t.Errorf("unexpected result: %v", result)
+	}
+
+	if n := <-wire; n >= 1000 {
+		t.Errorf("expected compressed request, got %d bytes", n)
+	}
+
+	if _, err = client.Result(ctx, &in, UseCompressor("identity")); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := <-wire; n < 1000 {
+		t.Errorf("expected uncompressed request, got %d bytes", n)
+	}
+
+	for _, s := range []string{"* Request Message: 1003 bytes", "* Response Message: "} {
+		if !strings.Contains(debug.String(), s) {
+			t.Errorf("debug output missing %q", s)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package zapi
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	msg "zvelo.io/msg/msgpb"
+)
+
+func TestUnixSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zapi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir) // #nosec
+
+	restLis, err := net.Listen("unix", filepath.Join(dir, "rest.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"request_id":"abc"}`))
+	})}
+	go func() { _ = srv.Serve(restLis) }()
+	defer srv.Close() // #nosec
+
+	grpcLis, err := net.Listen("unix", filepath.Join(dir, "grpc.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	grpcSrv := grpc.NewServer()
+	go func() { _ = grpcSrv.Serve(grpcLis) }()
+	defer grpcSrv.Stop()
+
+	var (
+		mu    sync.Mutex
+		dials []string
+	)
+
+	dialer := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		mu.Lock()
+		dials = append(dials, network+":"+addr)
+		mu.Unlock()
+
+		var d net.Dialer
+		return d.DialContext(ctx, network, addr)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rest := NewRESTv1(nil,
+		WithRestBaseURL("unix://"+restLis.Addr().String()),
+		WithDialer(dialer),
+	)
+
+	result, err := rest.Result(ctx, "abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.RequestId != "abc" {
+		t.Errorf("unexpected result: %v", result)
+	}
+
+	client, err := NewGRPCv1(nil,
+		WithoutTLS(),
+		WithGrpcTarget("unix://"+grpcLis.Addr().String()),
+		WithDialer(dialer),
+	).Dial(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close() // #nosec
+
+	// the server doesn't implement the api, so reaching it is enough
+	_, err = client.Result(ctx, &msg.RequestID{RequestId: "abc"})
+	if status.Code(err) != codes.Unimplemented {
+		t.Errorf("expected Unimplemented, got: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if len(dials) != 2 || dials[0] != "unix:"+restLis.Addr().String() || dials[1] != "unix:"+grpcLis.Addr().String() {
+		t.Errorf("unexpected dials: %v", dials)
+	}
+}
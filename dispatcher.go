@@ -0,0 +1,321 @@
+package zapi
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	msg "zvelo.io/msg/msgpb"
+)
+
+// DefaultOrphanSize is the number of complete results received on the stream
+// before their request was registered that a Dispatcher will hold unless
+// overridden with WithOrphanSize
+const DefaultOrphanSize = 1000
+
+// WithOrphanSize returns a StreamOption that sets how many complete results
+// received before their request was registered a Dispatcher will hold. It is
+// ignored by resilient streams.
+func WithOrphanSize(val int) StreamOption {
+	if val <= 0 {
+		val = DefaultOrphanSize
+	}
+
+	return func(o *streamOptions) {
+		o.orphanSize = val
+	}
+}
+
+// ErrDispatcherClosed is returned by Dispatcher methods and Futures after the
+// Dispatcher has been closed
+var ErrDispatcherClosed = errors.New("dispatcher closed")
+
+// A Future is the eventual complete QueryResult for a single request ID
+type Future interface {
+	// RequestID returns the request ID the Future is waiting for
+	RequestID() string
+
+	// Done returns a channel that is closed when the Future is resolved
+	Done() <-chan struct{}
+
+	// Get blocks until the Future is resolved or ctx is done. If ctx is done
+	// first, the Future is resolved with ctx.Err() and stops waiting for its
+	// result.
+	Get(ctx context.Context) (*msg.QueryResult, error)
+}
+
+type future struct {
+	d      *Dispatcher
+	reqID  string
+	done   chan struct{}
+	result *msg.QueryResult
+	err    error
+}
+
+func (f *future) RequestID() string {
+	return f.reqID
+}
+
+func (f *future) Done() <-chan struct{} {
+	return f.done
+}
+
+func (f *future) Get(ctx context.Context) (*msg.QueryResult, error) {
+	select {
+	case <-ctx.Done():
+		f.d.abandon(f, ctx.Err())
+	case <-f.done:
+	}
+
+	<-f.done
+	return f.result, f.err
+}
+
+func (f *future) resolve(result *msg.QueryResult, err error) {
+	f.result = result
+	f.err = err
+	close(f.done)
+}
+
+// A Dispatcher owns a single result stream and correlates the results
+// received on it with the queries made through QueryAsync
+type Dispatcher struct {
+	mu          sync.Mutex
+	query       queryFunc
+	cancel      context.CancelFunc
+	pending     map[string][]*future
+	orphans     map[string]*msg.QueryResult
+	orphanOrder []string
+	orphanSize  int
+	err         error
+}
+
+// NewRESTv1Dispatcher returns a Dispatcher that makes queries with client and
+// receives results with a ResilientRESTv1Stream configured with opts. The
+// Dispatcher is closed when ctx is done.
+func NewRESTv1Dispatcher(ctx context.Context, client RESTv1Client, opts ...StreamOption) (*Dispatcher, error) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	stream, err := ResilientRESTv1Stream(ctx, client, opts...)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	return newDispatcher(cancel, stream, streamDefaults(opts), func(ctx context.Context, in *msg.QueryRequests) (*msg.QueryReplies, error) {
+		return client.Query(ctx, in)
+	}), nil
+}
+
+// NewGRPCv1Dispatcher returns a Dispatcher that makes queries with client and
+// receives results with a ResilientGRPCv1Stream configured with opts. The
+// Dispatcher is closed when ctx is done.
+func NewGRPCv1Dispatcher(ctx context.Context, client GRPCv1Client, opts ...StreamOption) (*Dispatcher, error) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	stream, err := ResilientGRPCv1Stream(ctx, client, opts...)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	return newDispatcher(cancel, stream, streamDefaults(opts), func(ctx context.Context, in *msg.QueryRequests) (*msg.QueryReplies, error) {
+		return client.Query(ctx, in)
+	}), nil
+}
+
+// NewDispatcher returns a Dispatcher that makes queries and receives results
+// with c. Only WithOrphanSize applies from opts. The Dispatcher is closed when
+// ctx is done.
+func NewDispatcher(ctx context.Context, c Client, opts ...StreamOption) (*Dispatcher, error) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	stream, err := c.Stream(ctx)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	return newDispatcher(cancel, stream, streamDefaults(opts), func(ctx context.Context, in *msg.QueryRequests) (*msg.QueryReplies, error) {
+		return c.Query(ctx, in)
+	}), nil
+}
+
+func newDispatcher(cancel context.CancelFunc, stream StreamClient, o streamOptions, query queryFunc) *Dispatcher {
+	d := Dispatcher{
+		query:      query,
+		cancel:     cancel,
+		pending:    map[string][]*future{},
+		orphans:    map[string]*msg.QueryResult{},
+		orphanSize: o.orphanSize,
+	}
+
+	go d.recv(stream)
+
+	return &d
+}
+
+func (d *Dispatcher) recv(stream StreamClient) {
+	for {
+		result, err := stream.Recv()
+		if err != nil {
+			d.fail(err)
+			return
+		}
+
+		if IsComplete(result) {
+			d.dispatch(result)
+		}
+	}
+}
+
+func (d *Dispatcher) fail(err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.err == nil {
+		d.err = err
+	}
+
+	for reqID, fs := range d.pending {
+		for _, f := range fs {
+			f.resolve(nil, d.err)
+		}
+		delete(d.pending, reqID)
+	}
+}
+
+func (d *Dispatcher) dispatch(result *msg.QueryResult) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if fs, ok := d.pending[result.RequestId]; ok {
+		for _, f := range fs {
+			f.resolve(result, nil)
+		}
+		delete(d.pending, result.RequestId)
+		return
+	}
+
+	// the result arrived before Query returned its request id
+
+	if _, ok := d.orphans[result.RequestId]; ok {
+		return
+	}
+
+	if len(d.orphanOrder) >= d.orphanSize {
+		delete(d.orphans, d.orphanOrder[0])
+		d.orphanOrder = d.orphanOrder[1:]
+	}
+
+	d.orphans[result.RequestId] = result
+	d.orphanOrder = append(d.orphanOrder, result.RequestId)
+}
+
+func (d *Dispatcher) register(reqID string) *future {
+	f := future{
+		d:     d,
+		reqID: reqID,
+		done:  make(chan struct{}),
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.err != nil {
+		f.resolve(nil, d.err)
+		return &f
+	}
+
+	if result, ok := d.orphans[reqID]; ok {
+		delete(d.orphans, reqID)
+		f.resolve(result, nil)
+		return &f
+	}
+
+	d.pending[reqID] = append(d.pending[reqID], &f)
+	return &f
+}
+
+// abandon resolves f with err and stops waiting for its result, unless it was
+// already resolved
+func (d *Dispatcher) abandon(f *future, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	fs := d.pending[f.reqID]
+	for i, p := range fs {
+		if p != f {
+			continue
+		}
+
+		if len(fs) == 1 {
+			delete(d.pending, f.reqID)
+		} else {
+			d.pending[f.reqID] = append(fs[:i:i], fs[i+1:]...)
+		}
+
+		f.resolve(nil, err)
+		return
+	}
+}
+
+// QueryAllAsync queries zveloAPI and returns a Future for each URL in the
+// request, in the same order
+func (d *Dispatcher) QueryAllAsync(ctx context.Context, in *msg.QueryRequests) ([]Future, error) {
+	d.mu.Lock()
+	err := d.err
+	d.mu.Unlock()
+
+	if err != nil {
+		return nil, err
+	}
+
+	replies, err := d.query(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+
+	fs := make([]Future, len(replies.Reply))
+	for i, reply := range replies.Reply {
+		if reply == nil || reply.RequestId == "" {
+			err = errors.Errorf("no request_id for reply %d", i)
+			for _, f := range fs[:i] {
+				d.abandon(f.(*future), err)
+			}
+			return nil, err
+		}
+
+		fs[i] = d.register(reply.RequestId)
+	}
+
+	return fs, nil
+}
+
+// QueryAsync queries zveloAPI for a single URL and returns a Future that is
+// resolved when the complete result is received on the stream
+func (d *Dispatcher) QueryAsync(ctx context.Context, in *msg.QueryRequests) (Future, error) {
+	if in == nil || len(in.Url) != 1 {
+		return nil, errors.New("QueryAsync requires exactly one url, use QueryAllAsync instead")
+	}
+
+	fs, err := d.QueryAllAsync(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(fs) != 1 {
+		return nil, errors.Errorf("expected 1 reply, got %d", len(fs))
+	}
+
+	return fs[0], nil
+}
+
+// Close stops the stream and resolves all pending Futures with
+// ErrDispatcherClosed
+func (d *Dispatcher) Close() error {
+	d.fail(ErrDispatcherClosed)
+	d.cancel()
+	return nil
+}
@@ -0,0 +1,178 @@
+package zapi
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	msg "zvelo.io/msg/msgpb"
+)
+
+type chanStream struct {
+	ctx context.Context
+	ch  <-chan *msg.QueryResult
+}
+
+func (s chanStream) Recv() (*msg.QueryResult, error) {
+	select {
+	case <-s.ctx.Done():
+		return nil, s.ctx.Err()
+	case r := <-s.ch:
+		return r, nil
+	}
+}
+
+type streamingClient struct {
+	RESTv1Client
+	results chan *msg.QueryResult
+}
+
+func (c streamingClient) Stream(ctx context.Context) (RESTv1StreamClient, error) {
+	return chanStream{ctx: ctx, ch: c.results}, nil
+}
+
+func (c streamingClient) Query(ctx context.Context, in *msg.QueryRequests, opts ...CallOption) (*msg.QueryReplies, error) {
+	var replies msg.QueryReplies
+	for _, u := range in.Url {
+		replies.Reply = append(replies.Reply, &msg.QueryReply{RequestId: u})
+	}
+	return &replies, nil
+}
+
+func complete(reqID string) *msg.QueryResult {
+	return &msg.QueryResult{
+		RequestId:   reqID,
+		QueryStatus: &msg.QueryStatus{Complete: true},
+	}
+}
+
+func TestDispatcher(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client := streamingClient{results: make(chan *msg.QueryResult)}
+
+	d, err := NewRESTv1Dispatcher(ctx, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// result arrives before the query returns
+	client.results <- complete("a")
+
+	fa, err := d.QueryAsync(ctx, &msg.QueryRequests{Url: []string{"a"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fb, err := d.QueryAsync(ctx, &msg.QueryRequests{Url: []string{"b"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client.results <- &msg.QueryResult{RequestId: "b"} // incomplete, ignored
+	client.results <- complete("b")
+
+	for _, f := range []Future{fa, fb} {
+		result, err := f.Get(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if result.RequestId != f.RequestID() || !IsComplete(result) {
+			t.Errorf("unexpected result: %v", result)
+		}
+	}
+
+	if _, err = d.QueryAsync(ctx, &msg.QueryRequests{Url: []string{"a", "b"}}); err == nil {
+		t.Error("expected error for multiple urls")
+	}
+
+	fc, err := d.QueryAsync(ctx, &msg.QueryRequests{Url: []string{"c"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = d.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = fc.Get(ctx); err != ErrDispatcherClosed {
+		t.Errorf("expected ErrDispatcherClosed, got: %v", err)
+	}
+}
+
+// missingIDClient returns no request id for the last URL
+type missingIDClient struct {
+	streamingClient
+}
+
+func (c missingIDClient) Query(ctx context.Context, in *msg.QueryRequests, opts ...CallOption) (*msg.QueryReplies, error) {
+	replies, err := c.streamingClient.Query(ctx, in, opts...)
+	if err == nil {
+		replies.Reply[len(replies.Reply)-1].RequestId = ""
+	}
+	return replies, err
+}
+
+func TestDispatcherPending(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client := streamingClient{results: make(chan *msg.QueryResult)}
+
+	d, err := NewRESTv1Dispatcher(ctx, missingIDClient{client}, WithOrphanSize(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close() // #nosec
+
+	pending := func() int {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		return len(d.pending)
+	}
+
+	// futures registered before the error are removed
+	if _, err = d.QueryAllAsync(ctx, &msg.QueryRequests{Url: []string{"a", "b"}}); err == nil {
+		t.Error("expected error for missing request_id")
+	}
+
+	if n := pending(); n != 0 {
+		t.Errorf("expected no pending futures, got %d", n)
+	}
+
+	// a future is removed when Get is canceled
+	d.query = func(ctx context.Context, in *msg.QueryRequests) (*msg.QueryReplies, error) {
+		return client.Query(ctx, in)
+	}
+
+	f, err := d.QueryAsync(ctx, &msg.QueryRequests{Url: []string{"a"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gctx, gcancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer gcancel()
+
+	if _, err = f.Get(gctx); err != context.DeadlineExceeded {
+		t.Errorf("expected context.DeadlineExceeded, got: %v", err)
+	}
+
+	if n := pending(); n != 0 {
+		t.Errorf("expected no pending futures, got %d", n)
+	}
+
+	// only WithOrphanSize orphans are kept
+	client.results <- complete("x")
+	client.results <- complete("y")
+	client.results <- complete("z") // ensures y was dispatched
+
+	d.mu.Lock()
+	n := len(d.orphans)
+	d.mu.Unlock()
+
+	if n != 1 {
+		t.Errorf("expected 1 orphan, got %d", n)
+	}
+}
@@ -0,0 +1,74 @@
+package zapi
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gogo/protobuf/proto"
+
+	msg "zvelo.io/msg/msgpb"
+)
+
+func TestRESTEncoding(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			// server that only speaks json
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"request_id":"json"}`))
+			return
+		}
+
+		if ct := r.Header.Get("Content-Type"); ct != contentTypeProtobuf {
+			http.Error(w, "unexpected content type: "+ct, http.StatusBadRequest)
+			return
+		}
+
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		var in msg.QueryRequests
+		if err = proto.Unmarshal(data, &in); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		out, err := proto.Marshal(&msg.QueryReplies{
+			Reply: []*msg.QueryReply{{RequestId: in.Url[0]}},
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", contentTypeProtobuf)
+		_, _ = w.Write(out)
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	client := NewRESTv1(nil, WithRestBaseURL(srv.URL), WithRESTEncoding(Protobuf))
+
+	replies, err := client.Query(ctx, queryRequest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(replies.Reply) != 1 || replies.Reply[0].RequestId != queryURL {
+		t.Errorf("unexpected replies: %v", replies)
+	}
+
+	result, err := client.Result(ctx, "abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.RequestId != "json" {
+		t.Errorf("unexpected result: %v", result)
+	}
+}
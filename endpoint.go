@@ -0,0 +1,304 @@
+package zapi
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/empty"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	msg "zvelo.io/msg/msgpb"
+)
+
+// Defaults for passive endpoint health tracking, see WithEjection
+const (
+	DefaultMaxFailures  = 3
+	DefaultEjectionTime = 30 * time.Second
+)
+
+// latencySmoothing is the weight of each new sample in an endpoint's moving
+// average latency
+const latencySmoothing = 0.2
+
+// An APIEndpoint is a zveloAPI deployment, e.g. a region or a disaster
+// recovery stack. Either field may be empty if the APIEndpoint doesn't support
+// that transport.
+type APIEndpoint struct {
+	// RESTBaseURL is used by the RESTv1Client, see WithRestBaseURL
+	RESTBaseURL string
+
+	// GRPCTarget is used by the GRPCv1Client, see WithGrpcTarget
+	GRPCTarget string
+}
+
+// WithEndpoints returns an Option that causes both clients to send calls to
+// the first healthy APIEndpoint in val, in order, instead of the single
+// WithRestBaseURL or WithGrpcTarget. An APIEndpoint is ejected, and skipped,
+// after consecutive failures (see WithEjection).
+func WithEndpoints(val ...APIEndpoint) Option {
+	return func(o *options) {
+		o.endpoints = append([]APIEndpoint{}, val...)
+	}
+}
+
+// WithEjection returns an Option that ejects an APIEndpoint for ejectFor
+// after maxFailures consecutive calls to it fail because it was unreachable or
+// unavailable. An ejected APIEndpoint is tried again after ejectFor and
+// ejected again if that call also fails. Successful calls reset the failure
+// count. If not specified, DefaultMaxFailures and DefaultEjectionTime are
+// used.
+func WithEjection(maxFailures int, ejectFor time.Duration) Option {
+	if maxFailures <= 0 {
+		maxFailures = DefaultMaxFailures
+	}
+
+	if ejectFor <= 0 {
+		ejectFor = DefaultEjectionTime
+	}
+
+	return func(o *options) {
+		o.maxFailures = maxFailures
+		o.ejectFor = ejectFor
+	}
+}
+
+// WithLatencyPreference returns an Option that causes calls to be sent to the
+// healthy APIEndpoint with the lowest observed latency rather than the first
+// healthy APIEndpoint
+func WithLatencyPreference() Option {
+	return func(o *options) {
+		o.preferLatency = true
+	}
+}
+
+type endpoint struct {
+	index        int
+	failures     int
+	ejectedUntil time.Time
+	latency      time.Duration
+}
+
+// endpointSet tracks the health of endpoints
+type endpointSet struct {
+	mu            sync.Mutex
+	endpoints     []*endpoint
+	maxFailures   int
+	ejectFor      time.Duration
+	preferLatency bool
+	now           func() time.Time
+}
+
+func newEndpointSet(o *options, n int) *endpointSet {
+	s := endpointSet{
+		endpoints:     make([]*endpoint, n),
+		maxFailures:   o.maxFailures,
+		ejectFor:      o.ejectFor,
+		preferLatency: o.preferLatency,
+		now:           time.Now,
+	}
+
+	if s.maxFailures <= 0 {
+		s.maxFailures = DefaultMaxFailures
+	}
+
+	if s.ejectFor <= 0 {
+		s.ejectFor = DefaultEjectionTime
+	}
+
+	for i := range s.endpoints {
+		s.endpoints[i] = &endpoint{index: i}
+	}
+
+	return &s
+}
+
+// pick returns the index of the endpoint to use for the next call. If every
+// endpoint is ejected, the one that will be readmitted first is used.
+func (s *endpointSet) pick() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+
+	var best, soonest *endpoint
+	for _, e := range s.endpoints {
+		if now.Before(e.ejectedUntil) {
+			if soonest == nil || e.ejectedUntil.Before(soonest.ejectedUntil) {
+				soonest = e
+			}
+			continue
+		}
+
+		if best == nil {
+			best = e
+			if !s.preferLatency {
+				break
+			}
+			continue
+		}
+
+		if e.latency < best.latency {
+			best = e
+		}
+	}
+
+	if best == nil {
+		best = soonest
+	}
+
+	return best.index
+}
+
+// report records the outcome of a call to endpoint i
+func (s *endpointSet) report(i int, failed bool, latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e := s.endpoints[i]
+
+	if failed {
+		e.failures++
+		if e.failures >= s.maxFailures {
+			e.ejectedUntil = s.now().Add(s.ejectFor)
+		}
+		return
+	}
+
+	e.failures = 0
+	e.ejectedUntil = time.Time{}
+
+	if e.latency == 0 {
+		e.latency = latency
+	} else {
+		e.latency += time.Duration(latencySmoothing * float64(latency-e.latency))
+	}
+}
+
+// restEndpoints rewrites REST requests to the healthiest endpoint
+type restEndpoints struct {
+	*endpointSet
+	base *url.URL
+	urls []*url.URL
+}
+
+func newRESTEndpoints(o *options) *restEndpoints {
+	scheme := "https"
+	if o.withoutTLS {
+		scheme = "http"
+	}
+
+	var urls []*url.URL
+	for _, e := range o.endpoints {
+		if e.RESTBaseURL == "" {
+			continue
+		}
+
+		if u, err := parseBaseURL(e.RESTBaseURL, scheme); err == nil {
+			urls = append(urls, u)
+		}
+	}
+
+	if len(urls) == 0 {
+		return nil
+	}
+
+	return &restEndpoints{
+		endpointSet: newEndpointSet(o, len(urls)),
+		base:        o.restBaseURL,
+		urls:        urls,
+	}
+}
+
+// rewrite points req, which was built relative to the default base url, at
+// endpoint i
+func (r *restEndpoints) rewrite(req *http.Request, i int) {
+	u := *req.URL
+	e := r.urls[i]
+
+	rel := strings.TrimPrefix(u.Path, strings.TrimSuffix(r.base.Path, "/"))
+
+	u.Scheme = e.Scheme
+	u.Host = e.Host
+	u.Path = strings.TrimSuffix(e.Path, "/") + rel
+
+	req.URL = &u
+	req.Host = e.Host
+}
+
+// restFailure returns whether the result of a round trip indicates that the
+// endpoint is unhealthy
+func restFailure(res *http.Response, err error) bool {
+	if err != nil {
+		return err != context.Canceled && err != context.DeadlineExceeded
+	}
+
+	return res.StatusCode == http.StatusBadGateway ||
+		res.StatusCode == http.StatusServiceUnavailable ||
+		res.StatusCode == http.StatusGatewayTimeout
+}
+
+// grpcV1Endpoints is a GRPCv1Client that sends calls to the healthiest of
+// several connections, one per endpoint
+type grpcV1Endpoints struct {
+	*grpcV1Pool
+	set *endpointSet
+}
+
+func newGRPCv1Endpoints(o *options, conns []GRPCv1Client) *grpcV1Endpoints {
+	return &grpcV1Endpoints{
+		grpcV1Pool: newGRPCv1Pool(conns),
+		set:        newEndpointSet(o, len(conns)),
+	}
+}
+
+// grpcFailure returns whether err indicates that the endpoint is unhealthy
+func grpcFailure(err error) bool {
+	return status.Code(err) == codes.Unavailable
+}
+
+func (c *grpcV1Endpoints) call(fn func(GRPCv1Client) error) error {
+	i := c.set.pick()
+	start := c.set.now()
+	err := fn(c.conns[i].GRPCv1Client)
+	c.set.report(i, grpcFailure(err), c.set.now().Sub(start))
+	return err
+}
+
+func (c *grpcV1Endpoints) Query(ctx context.Context, in *msg.QueryRequests, opts ...grpc.CallOption) (resp *msg.QueryReplies, err error) {
+	err = c.call(func(conn GRPCv1Client) error {
+		resp, err = conn.Query(ctx, in, opts...)
+		return err
+	})
+	return
+}
+
+func (c *grpcV1Endpoints) Result(ctx context.Context, in *msg.RequestID, opts ...grpc.CallOption) (resp *msg.QueryResult, err error) {
+	err = c.call(func(conn GRPCv1Client) error {
+		resp, err = conn.Result(ctx, in, opts...)
+		return err
+	})
+	return
+}
+
+func (c *grpcV1Endpoints) Suggest(ctx context.Context, in *msg.Suggestion, opts ...grpc.CallOption) (resp *empty.Empty, err error) {
+	err = c.call(func(conn GRPCv1Client) error {
+		resp, err = conn.Suggest(ctx, in, opts...)
+		return err
+	})
+	return
+}
+
+func (c *grpcV1Endpoints) Stream(ctx context.Context, in *empty.Empty, opts ...grpc.CallOption) (stream msg.APIv1_StreamClient, err error) {
+	err = c.call(func(conn GRPCv1Client) error {
+		stream, err = conn.Stream(ctx, in, opts...)
+		return err
+	})
+	return
+}
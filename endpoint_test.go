@@ -0,0 +1,103 @@
+package zapi
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEndpoints(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down for maintenance", http.StatusServiceUnavailable)
+	}))
+	defer primary.Close()
+
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/dr/v1/query/abc" {
+			http.NotFound(w, r)
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"request_id":"abc"}`))
+	}))
+	defer secondary.Close()
+
+	var debug bytes.Buffer
+
+	client := NewRESTv1(nil,
+		WithEndpoints(
+			APIEndpoint{RESTBaseURL: primary.URL},
+			APIEndpoint{RESTBaseURL: secondary.URL + "/dr/"},
+		),
+		WithEjection(1, time.Hour),
+		WithDebug(&debug),
+	)
+
+	ctx := context.Background()
+
+	if _, err := client.Result(ctx, "abc"); err == nil {
+		t.Error("expected primary to fail")
+	}
+
+	// the primary was ejected
+	result, err := client.Result(ctx, "abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.RequestId != "abc" {
+		t.Errorf("unexpected result: %v", result)
+	}
+
+	// the debug dump shows the rewritten request
+	if !strings.Contains(debug.String(), "GET /dr/v1/query/abc") {
+		t.Errorf("debug output missing the rewritten request:\n%s", debug.String())
+	}
+}
+
+func TestEndpointSet(t *testing.T) {
+	o := defaults(nil)
+	WithLatencyPreference()(o)
+
+	s := newEndpointSet(o, 3)
+
+	now := time.Now()
+	s.now = func() time.Time { return now }
+
+	s.report(0, false, 30*time.Millisecond)
+	s.report(1, false, 10*time.Millisecond)
+	s.report(2, false, 20*time.Millisecond)
+
+	if i := s.pick(); i != 1 {
+		t.Errorf("expected fastest endpoint, got %d", i)
+	}
+
+	for i := 0; i < DefaultMaxFailures; i++ {
+		s.report(1, true, 0)
+	}
+
+	if i := s.pick(); i != 2 {
+		t.Errorf("expected fastest healthy endpoint, got %d", i)
+	}
+
+	now = now.Add(time.Second)
+
+	for i := 0; i < DefaultMaxFailures; i++ {
+		s.report(0, true, 0)
+		s.report(2, true, 0)
+	}
+
+	if i := s.pick(); i != 1 {
+		t.Errorf("expected first ejected endpoint to be readmitted first, got %d", i)
+	}
+
+	now = now.Add(DefaultEjectionTime - time.Second)
+
+	if i := s.pick(); i != 1 {
+		t.Errorf("expected readmitted endpoint, got %d", i)
+	}
+}
@@ -0,0 +1,291 @@
+package zapi
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/status"
+
+	msg "zvelo.io/msg/msgpb"
+)
+
+// DefaultProbeInterval is how long a FailoverClient uses REST before trying
+// gRPC again unless overridden with WithProbeInterval
+const DefaultProbeInterval = time.Minute
+
+type failoverOptions struct {
+	probeInterval time.Duration
+}
+
+// A FailoverOption configures a FailoverClient
+type FailoverOption func(*failoverOptions)
+
+// WithProbeInterval returns a FailoverOption that sets how long the
+// FailoverClient uses REST after gRPC fails before trying gRPC again
+func WithProbeInterval(val time.Duration) FailoverOption {
+	if val <= 0 {
+		val = DefaultProbeInterval
+	}
+
+	return func(o *failoverOptions) {
+		o.probeInterval = val
+	}
+}
+
+// ServedByCallOption records the Protocol that served a call made with a
+// FailoverClient. Other clients ignore it.
+type ServedByCallOption struct {
+	grpc.EmptyCallOption
+	p *Protocol
+}
+
+func (ServedByCallOption) before(*http.Request) {}
+func (ServedByCallOption) after(*http.Response) {}
+
+var _ CallOption = ServedByCallOption{}
+
+// ServedBy returns a ServedByCallOption that sets p to the Protocol that
+// served the call
+func ServedBy(p *Protocol) ServedByCallOption {
+	return ServedByCallOption{p: p}
+}
+
+// A FailoverClient is a Client that uses gRPC when possible and falls back to
+// REST when gRPC can't be dialed or its connection fails, e.g. because a
+// network blocks HTTP/2. Errors sent by the server, even Unavailable, don't
+// cause a failover. After falling back, gRPC is tried again once the probe
+// interval has passed and its connection is usable.
+//
+// A call that fails over is sent again using REST, except for Query, which is
+// only sent again if dialer was created with a RetryPolicy that sets
+// RetryQuery. Otherwise the gRPC error is returned.
+type FailoverClient struct {
+	options    failoverOptions
+	dialer     GRPCv1Dialer
+	restV1     RESTv1Client
+	rest       Client
+	retryQuery bool
+	mu         sync.Mutex
+	grpc       GRPCv1Client
+	useREST    bool
+	probeAt    time.Time
+	now        func() time.Time
+}
+
+var _ Client = (*FailoverClient)(nil)
+
+// NewFailoverClient returns a FailoverClient that dials gRPC with dialer and
+// falls back to rest. If dialing fails, the FailoverClient starts out using
+// REST.
+func NewFailoverClient(ctx context.Context, dialer GRPCv1Dialer, rest RESTv1Client, opts ...FailoverOption) *FailoverClient {
+	c := FailoverClient{
+		options: failoverOptions{probeInterval: DefaultProbeInterval},
+		dialer:  dialer,
+		restV1:  rest,
+		rest:    FromRESTv1(rest),
+		now:     time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(&c.options)
+	}
+
+	if d, ok := dialer.(grpcV1Dialer); ok {
+		c.retryQuery = d.options.retry.retryQuery()
+	}
+
+	if conn, err := dialer.Dial(ctx); err == nil {
+		c.grpc = conn
+	} else {
+		c.failover()
+	}
+
+	return &c
+}
+
+// Protocol returns the Protocol that will be used for the next call
+func (c *FailoverClient) Protocol() Protocol {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.useREST {
+		return ProtocolREST
+	}
+
+	return ProtocolGRPC
+}
+
+// failover switches to REST until the probe interval has passed. c.mu must be
+// held or c must not yet be shared.
+func (c *FailoverClient) failover() {
+	c.useREST = true
+	c.probeAt = c.now().Add(c.options.probeInterval)
+}
+
+// pick returns the client to use for the next call
+func (c *FailoverClient) pick(ctx context.Context) (Client, Protocol) {
+	c.mu.Lock()
+	probe := c.useREST && !c.now().Before(c.probeAt)
+	if probe {
+		// keep other calls on REST while this one probes
+		c.failover()
+	}
+	c.mu.Unlock()
+
+	if probe {
+		c.probe(ctx)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.useREST {
+		return c.rest, ProtocolREST
+	}
+
+	return FromGRPCv1(c.grpc), ProtocolGRPC
+}
+
+// probe switches back to gRPC if its connection is usable. c.mu must not be
+// held since gRPC may need to be dialed.
+func (c *FailoverClient) probe(ctx context.Context) {
+	c.mu.Lock()
+	dial := c.grpc == nil
+	c.mu.Unlock()
+
+	var conn GRPCv1Client
+	var err error
+	if dial {
+		conn, err = c.dialer.Dial(ctx)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err != nil {
+		c.failover()
+		return
+	}
+
+	if conn != nil {
+		if c.grpc == nil {
+			c.grpc = conn
+		} else {
+			// another call dialed first
+			_ = conn.Close() // #nosec
+		}
+	}
+
+	switch c.grpc.State() {
+	case connectivity.Ready, connectivity.Idle:
+		c.useREST = false
+	default:
+		c.failover()
+	}
+}
+
+// transportErr returns whether err, returned by a gRPC call, means that gRPC
+// can't reach zveloAPI. Since the server may send Unavailable as well, it is
+// only a transport error if the connection isn't READY.
+func (c *FailoverClient) transportErr(err error) bool {
+	if status.Code(err) != codes.Unavailable {
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.grpc.State() != connectivity.Ready
+}
+
+// do calls fn with the client to use. If gRPC fails, fn is called again with
+// the REST client if resend is true.
+func (c *FailoverClient) do(ctx context.Context, resend bool, opts []CallOption, fn func(Client) error) error {
+	client, p := c.pick(ctx)
+
+	err := fn(client)
+	if p == ProtocolGRPC && ctx.Err() == nil && c.transportErr(err) {
+		c.mu.Lock()
+		c.failover()
+		c.mu.Unlock()
+
+		if resend {
+			client, p = c.rest, ProtocolREST
+			err = fn(client)
+		}
+	}
+
+	for _, opt := range opts {
+		if o, ok := opt.(ServedByCallOption); ok && o.p != nil {
+			*o.p = p
+		}
+	}
+
+	return err
+}
+
+// Query implements Client
+func (c *FailoverClient) Query(ctx context.Context, in *msg.QueryRequests, opts ...CallOption) (resp *msg.QueryReplies, err error) {
+	err = c.do(ctx, c.retryQuery, opts, func(client Client) error {
+		resp, err = client.Query(ctx, in, opts...)
+		return err
+	})
+	return
+}
+
+// Result implements Client
+func (c *FailoverClient) Result(ctx context.Context, reqID string, opts ...CallOption) (resp *msg.QueryResult, err error) {
+	err = c.do(ctx, true, opts, func(client Client) error {
+		resp, err = client.Result(ctx, reqID, opts...)
+		return err
+	})
+	return
+}
+
+// Suggest implements Client
+func (c *FailoverClient) Suggest(ctx context.Context, in *msg.Suggestion, opts ...CallOption) error {
+	return c.do(ctx, true, opts, func(client Client) error {
+		return client.Suggest(ctx, in, opts...)
+	})
+}
+
+// Stream implements Client. Use Protocol to see which transport the stream
+// was opened with.
+func (c *FailoverClient) Stream(ctx context.Context) (stream StreamClient, err error) {
+	err = c.do(ctx, true, nil, func(client Client) error {
+		stream, err = client.Stream(ctx)
+		return err
+	})
+	return
+}
+
+// GraphQL sends query using REST, the only protocol that supports GraphQL
+func (c *FailoverClient) GraphQL(ctx context.Context, query string, result interface{}, opts ...CallOption) error {
+	return c.restV1.GraphQL(ctx, query, result, opts...)
+}
+
+// ExecGraphQL implements GraphQLExecutor using REST
+func (c *FailoverClient) ExecGraphQL(ctx context.Context, req *GraphQLRequest, data interface{}, opts ...CallOption) error {
+	return execGraphQL(ctx, c.restV1, req, data, opts...)
+}
+
+// Close closes both the gRPC and REST clients
+func (c *FailoverClient) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	err := c.rest.Close()
+
+	if c.grpc != nil {
+		if gerr := c.grpc.Close(); gerr != nil && err == nil {
+			err = gerr
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,231 @@
+package zapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/status"
+
+	msg "zvelo.io/msg/msgpb"
+)
+
+type failoverTestConn struct {
+	GRPCv1Client
+	err    error
+	state  connectivity.State
+	calls  int
+	closed bool
+}
+
+func (c *failoverTestConn) Result(ctx context.Context, in *msg.RequestID, opts ...grpc.CallOption) (*msg.QueryResult, error) {
+	c.calls++
+	if c.err != nil {
+		return nil, c.err
+	}
+	return &msg.QueryResult{RequestId: "grpc"}, nil
+}
+
+func (c *failoverTestConn) Query(ctx context.Context, in *msg.QueryRequests, opts ...grpc.CallOption) (*msg.QueryReplies, error) {
+	c.calls++
+	if c.err != nil {
+		return nil, c.err
+	}
+	return &msg.QueryReplies{}, nil
+}
+
+func (c *failoverTestConn) State() connectivity.State {
+	return c.state
+}
+
+func (c *failoverTestConn) Close() error {
+	c.closed = true
+	return nil
+}
+
+type failoverTestDialer struct {
+	conn *failoverTestConn
+}
+
+func (d failoverTestDialer) Dial(context.Context, ...grpc.DialOption) (GRPCv1Client, error) {
+	return d.conn, nil
+}
+
+type failoverDialerFunc func(context.Context) (GRPCv1Client, error)
+
+func (fn failoverDialerFunc) Dial(ctx context.Context, _ ...grpc.DialOption) (GRPCv1Client, error) {
+	return fn(ctx)
+}
+
+func TestFailover(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"request_id":"rest"}`))
+	}))
+	defer srv.Close()
+
+	conn := failoverTestConn{
+		err:   status.Error(codes.Unavailable, "http2 blocked"),
+		state: connectivity.TransientFailure,
+	}
+
+	ctx := context.Background()
+	c := NewFailoverClient(ctx, failoverTestDialer{conn: &conn}, NewRESTv1(nil, WithRestBaseURL(srv.URL)))
+
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	expect := func(reqID string, p Protocol) {
+		t.Helper()
+
+		var served Protocol
+		result, err := c.Result(ctx, "abc", ServedBy(&served))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if result.RequestId != reqID || served != p {
+			t.Errorf("expected %s served by %s, got %s served by %s", reqID, p, result.RequestId, served)
+		}
+	}
+
+	// gRPC fails and the call is sent over REST
+	expect("rest", ProtocolREST)
+
+	if conn.calls != 1 || c.Protocol() != ProtocolREST {
+		t.Errorf("expected failover to REST, got %d calls, %s", conn.calls, c.Protocol())
+	}
+
+	// gRPC isn't tried again until the probe interval has passed
+	expect("rest", ProtocolREST)
+
+	now = now.Add(DefaultProbeInterval)
+
+	// the connection still isn't ready
+	expect("rest", ProtocolREST)
+
+	if conn.calls != 1 {
+		t.Errorf("expected gRPC not to be called, got %d calls", conn.calls)
+	}
+
+	now = now.Add(DefaultProbeInterval)
+	conn.err = nil
+	conn.state = connectivity.Ready
+
+	expect("grpc", ProtocolGRPC)
+
+	if c.Protocol() != ProtocolGRPC {
+		t.Errorf("expected gRPC, got %s", c.Protocol())
+	}
+}
+
+func TestFailoverServerErrors(t *testing.T) {
+	var restCalls int
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		restCalls++
+		_, _ = w.Write([]byte(`{"request_id":"rest"}`))
+	}))
+	defer srv.Close()
+
+	conn := failoverTestConn{state: connectivity.Ready}
+
+	ctx := context.Background()
+	c := NewFailoverClient(ctx, failoverTestDialer{conn: &conn}, NewRESTv1(nil, WithRestBaseURL(srv.URL)))
+
+	// errors sent by the server are returned without failing over
+	for _, code := range []codes.Code{codes.Unavailable, codes.Unimplemented} {
+		conn.err = status.Error(code, "server error")
+
+		if _, err := c.Result(ctx, "abc"); status.Code(err) != code {
+			t.Errorf("expected %s, got: %v", code, err)
+		}
+
+		if c.Protocol() != ProtocolGRPC {
+			t.Errorf("%s: expected no failover", code)
+		}
+	}
+
+	// a Query isn't sent again after a transport error
+	conn.err = status.Error(codes.Unavailable, "connection refused")
+	conn.state = connectivity.TransientFailure
+
+	if _, err := c.Query(ctx, queryRequest); status.Code(err) != codes.Unavailable {
+		t.Errorf("expected Unavailable, got: %v", err)
+	}
+
+	if c.Protocol() != ProtocolREST {
+		t.Error("expected failover to REST")
+	}
+
+	if restCalls != 0 {
+		t.Errorf("expected Query not to be sent using REST, got %d calls", restCalls)
+	}
+}
+
+func TestFailoverProbeDial(t *testing.T) {
+	dialing := make(chan struct{})
+	release := make(chan struct{})
+
+	loser := failoverTestConn{state: connectivity.Ready}
+	winner := failoverTestConn{state: connectivity.Ready}
+
+	var dials int
+	dialer := failoverDialerFunc(func(context.Context) (GRPCv1Client, error) {
+		dials++
+		if dials == 1 {
+			return nil, errors.New("dial failed")
+		}
+
+		close(dialing)
+		<-release
+		return &loser, nil
+	})
+
+	ctx := context.Background()
+	c := NewFailoverClient(ctx, dialer, NewRESTv1(nil))
+
+	now := time.Now().Add(DefaultProbeInterval)
+	c.now = func() time.Time { return now }
+
+	done := make(chan *msg.QueryResult)
+	go func() {
+		result, _ := c.Result(ctx, "abc")
+		done <- result
+	}()
+
+	<-dialing
+
+	// the lock isn't held while dialing
+	protocol := make(chan Protocol)
+	go func() { protocol <- c.Protocol() }()
+
+	select {
+	case p := <-protocol:
+		if p != ProtocolREST {
+			t.Errorf("expected REST while probing, got %s", p)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Protocol blocked while dialing")
+	}
+
+	// another call dials first
+	c.mu.Lock()
+	c.grpc = &winner
+	c.mu.Unlock()
+
+	close(release)
+
+	if result := <-done; result == nil || result.RequestId != "grpc" {
+		t.Errorf("expected result from gRPC, got: %v", result)
+	}
+
+	if !loser.closed || winner.closed || winner.calls != 1 {
+		t.Errorf("expected the losing conn to be closed, got loser closed: %v, winner closed: %v, winner calls: %d", loser.closed, winner.closed, winner.calls)
+	}
+}
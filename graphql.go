@@ -0,0 +1,146 @@
+package zapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// A GraphQLRequest is a GraphQL query, or mutation, along with its variables
+type GraphQLRequest struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+	OperationName string                 `json:"operationName,omitempty"`
+}
+
+// A GraphQLLocation identifies the position in the query that caused a
+// GraphQLError
+type GraphQLLocation struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// A GraphQLError is a single error returned in the errors array of a GraphQL
+// response
+type GraphQLError struct {
+	Message    string                 `json:"message"`
+	Path       []interface{}          `json:"path,omitempty"`
+	Locations  []GraphQLLocation      `json:"locations,omitempty"`
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+}
+
+func (e GraphQLError) Error() string {
+	if len(e.Path) == 0 {
+		return e.Message
+	}
+
+	parts := make([]string, len(e.Path))
+	for i, p := range e.Path {
+		parts[i] = fmt.Sprint(p)
+	}
+
+	return strings.Join(parts, ".") + ": " + e.Message
+}
+
+// GraphQLErrors is returned by GraphQL and ExecGraphQL when the response
+// contains a non-empty errors array, even if the response status isn't 200 OK.
+// Any data in a successful response is still decoded.
+type GraphQLErrors []GraphQLError
+
+func (e GraphQLErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+
+	return "graphql: " + strings.Join(msgs, "; ")
+}
+
+// A GraphQLExecutor sends GraphQL requests with variables. It is implemented
+// by the RESTv1Client returned by NewRESTv1 and forwarded by BatchRESTv1,
+// CacheRESTv1 and FailoverClient.
+type GraphQLExecutor interface {
+	ExecGraphQL(ctx context.Context, req *GraphQLRequest, data interface{}, opts ...CallOption) error
+}
+
+var (
+	_ GraphQLExecutor = (*restV1Client)(nil)
+	_ GraphQLExecutor = restV1Batcher{}
+	_ GraphQLExecutor = restV1Cache{}
+	_ GraphQLExecutor = (*FailoverClient)(nil)
+)
+
+// execGraphQL forwards an ExecGraphQL call to client
+func execGraphQL(ctx context.Context, client RESTv1Client, req *GraphQLRequest, data interface{}, opts ...CallOption) error {
+	e, ok := client.(GraphQLExecutor)
+	if !ok {
+		return errors.New("client does not implement GraphQLExecutor")
+	}
+
+	return e.ExecGraphQL(ctx, req, data, opts...)
+}
+
+type graphQLResponse struct {
+	Data   json.RawMessage `json:"data"`
+	Errors GraphQLErrors   `json:"errors"`
+}
+
+func (c *restV1Client) graphQL(ctx context.Context, req *GraphQLRequest, opts ...CallOption) (io.ReadCloser, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	rc, err := c.do(ctx, "POST", c.options.restURL(graphQLPath), bytes.NewReader(body), opts...)
+	if herr, ok := err.(*HTTPError); ok {
+		// non-200 responses may still contain errors
+		var resp graphQLResponse
+		if json.Unmarshal(herr.Body, &resp) == nil && len(resp.Errors) > 0 {
+			return nil, resp.Errors
+		}
+	}
+
+	return rc, err
+}
+
+// ExecGraphQL sends req and decodes only the data field of the response into
+// data. If data is a *string, it receives the raw JSON of the data field. If
+// the response contains errors, they are returned as GraphQLErrors.
+func (c *restV1Client) ExecGraphQL(ctx context.Context, req *GraphQLRequest, data interface{}, opts ...CallOption) (err error) {
+	ctx, cancel := c.options.withTimeout(ctx, MethodGraphQL)
+	defer cancel()
+	ctx = withMethod(ctx, MethodGraphQL)
+
+	ctx, span := c.options.startSpan(ctx, MethodGraphQL)
+	defer func() { span.End(err) }()
+
+	body, err := c.graphQL(ctx, req, opts...)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = body.Close() }() // #nosec
+
+	var resp graphQLResponse
+	if err = json.NewDecoder(body).Decode(&resp); err != nil {
+		return err
+	}
+
+	if len(resp.Data) > 0 && data != nil {
+		if ps, ok := data.(*string); ok {
+			*ps = string(resp.Data)
+		} else if err = json.Unmarshal(resp.Data, data); err != nil {
+			return err
+		}
+	}
+
+	if len(resp.Errors) > 0 {
+		return resp.Errors
+	}
+
+	return nil
+}
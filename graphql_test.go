@@ -0,0 +1,98 @@
+package zapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestExecGraphQL(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req GraphQLRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if req.OperationName == "invalid" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"errors":[{"message":"syntax error"}]}`))
+			return
+		}
+
+		if req.OperationName == "fail" || req.Query == "{ fail }" {
+			_, _ = w.Write([]byte(`{"data":{"url":null},"errors":[{"message":"bad url","path":["url",0],"locations":[{"line":2,"column":3}]}]}`))
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{
+				"url": map[string]interface{}{"requestID": req.Variables["url"]},
+			},
+		})
+	}))
+	defer srv.Close()
+
+	client := NewRESTv1(nil, WithRestBaseURL(srv.URL)).(GraphQLExecutor)
+	ctx := context.Background()
+
+	req := GraphQLRequest{
+		Query:     `query($url: String!) { url(url: $url) { requestID } }`,
+		Variables: map[string]interface{}{"url": "http://example.com"},
+	}
+
+	var data graphQLReply
+	if err := client.ExecGraphQL(ctx, &req, &data.Data); err != nil {
+		t.Fatal(err)
+	}
+
+	if data.Data.URL.RequestID != "http://example.com" {
+		t.Errorf("unexpected data: %+v", data)
+	}
+
+	req.OperationName = "fail"
+	err := client.ExecGraphQL(ctx, &req, &data.Data)
+
+	errs, ok := err.(GraphQLErrors)
+	if !ok || len(errs) != 1 {
+		t.Fatalf("expected GraphQLErrors, got: %v", err)
+	}
+
+	if errs[0].Message != "bad url" || len(errs[0].Locations) != 1 || errs[0].Locations[0].Line != 2 {
+		t.Errorf("unexpected error: %+v", errs[0])
+	}
+
+	if errs.Error() != "graphql: url.0: bad url" {
+		t.Errorf("unexpected error string: %s", errs.Error())
+	}
+
+	// errors are decoded from non-200 responses
+
+	req.OperationName = "invalid"
+	err = client.ExecGraphQL(ctx, &req, &data.Data)
+
+	if errs, ok := err.(GraphQLErrors); !ok || len(errs) != 1 || errs[0].Message != "syntax error" {
+		t.Errorf("expected GraphQLErrors, got: %v", err)
+	}
+
+	// GraphQL returns errors as well
+	var raw string
+	err = NewRESTv1(nil, WithRestBaseURL(srv.URL)).GraphQL(ctx, "{ fail }", &raw)
+
+	if errs, ok := err.(GraphQLErrors); !ok || len(errs) != 1 || raw == "" {
+		t.Errorf("expected GraphQLErrors and the raw response, got: %v, %q", err, raw)
+	}
+
+	// ExecGraphQL is forwarded by wrappers
+	wrapped, ok := CacheRESTv1(BatchRESTv1(NewRESTv1(nil, WithRestBaseURL(srv.URL))), NewResultCache()).(GraphQLExecutor)
+	if !ok {
+		t.Fatal("expected wrapped client to implement GraphQLExecutor")
+	}
+
+	req.OperationName = ""
+	if err = wrapped.ExecGraphQL(ctx, &req, &data.Data); err != nil {
+		t.Fatal(err)
+	}
+}
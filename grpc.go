@@ -2,38 +2,62 @@ package zapi
 
 import (
 	"context"
-	"crypto/tls"
 	"io"
+	"net"
+	"strings"
 
 	"github.com/golang/protobuf/ptypes/empty"
+	"github.com/pkg/errors"
 
 	"golang.org/x/oauth2"
 
 	"google.golang.org/grpc"
 	_ "google.golang.org/grpc/balancer/grpclb" // register the grpclb balancer
+	"google.golang.org/grpc/connectivity"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/oauth"
-	"google.golang.org/grpc/metadata"
+	_ "google.golang.org/grpc/encoding/gzip" // register the gzip compressor
 
-	"zvelo.io/go-zapi/internal/zvelo"
 	msg "zvelo.io/msg/msgpb"
 )
 
+// ErrConnShutdown is returned by WaitForReady when the underlying gRPC
+// connection has been closed
+var ErrConnShutdown = errors.New("grpc connection is shut down")
+
 // A GRPCv1Client implements msg.APIv1Client as well as an io.Closer that, if
 // closed, will close the underlying gRPC connection.
 type GRPCv1Client interface {
 	msg.APIv1Client
 	io.Closer
+
+	// State returns the connectivity state of the underlying gRPC connection
+	State() connectivity.State
+
+	// WaitForReady blocks until the underlying gRPC connection is READY, ctx is
+	// done or the connection is shut down
+	WaitForReady(ctx context.Context) error
+
+	// WatchState returns a channel that receives the current connectivity
+	// state and then every change to it. The channel is closed when ctx is
+	// done or after the connection is shut down.
+	WatchState(ctx context.Context) <-chan connectivity.State
 }
 
 type grpcV1Client struct {
 	options *options
 	client  msg.APIv1Client
+	conn    *grpc.ClientConn
 	io.Closer
 }
 
 // A GRPCv1Dialer is used to simplify connecting to zveloAPI with the correct
-// options. grpc DialOptions will override the defaults.
+// options. grpc DialOptions are applied after, and so override, the defaults.
+// The built-in interceptors and stats handler, which implement tracing,
+// timeouts, retries, debugging and metrics, are always installed. An
+// interceptor passed with grpc.WithUnaryInterceptor or
+// grpc.WithStreamInterceptor is called before them. Use WithStatsHandler
+// rather than grpc.WithStatsHandler, which is overridden by the built-in one.
 type GRPCv1Dialer interface {
 	Dial(context.Context, ...grpc.DialOption) (GRPCv1Client, error)
 }
@@ -43,15 +67,16 @@ type grpcV1Dialer struct {
 }
 
 func (d grpcV1Dialer) Dial(ctx context.Context, opts ...grpc.DialOption) (GRPCv1Client, error) {
-	dialOpts := append([]grpc.DialOption{}, opts...)
+	if d.options.proxyErr != nil {
+		return nil, d.options.proxyErr
+	}
+
+	var dialOpts []grpc.DialOption
 
 	if d.options.withoutTLS {
 		dialOpts = append(dialOpts, grpc.WithInsecure())
 	} else {
-		// #nosec
-		dialOpts = append(dialOpts, grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{
-			InsecureSkipVerify: d.options.tlsInsecureSkipVerify,
-		})))
+		dialOpts = append(dialOpts, grpc.WithTransportCredentials(credentials.NewTLS(d.options.clientTLS())))
 	}
 
 	if d.options.TokenSource != nil {
@@ -62,7 +87,93 @@ func (d grpcV1Dialer) Dial(ctx context.Context, opts ...grpc.DialOption) (GRPCv1
 		)
 	}
 
-	conn, err := grpc.DialContext(ctx, d.options.grpcTarget, dialOpts...)
+	if d.options.proxy != nil {
+		// fail early on unsupported proxies
+		if _, err := proxyDialer(d.options.proxy, d.options.dialContext, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	if d.options.keepalive != nil {
+		dialOpts = append(dialOpts, grpc.WithKeepaliveParams(*d.options.keepalive))
+	}
+
+	if d.options.grpcCompressor != "" {
+		dialOpts = append(dialOpts, grpc.WithDefaultCallOptions(grpc.UseCompressor(d.options.grpcCompressor)))
+	}
+
+	// the chained interceptors are kept even if the caller sets an
+	// interceptor, which grpc prepends to the chain
+	dialOpts = append(dialOpts,
+		grpc.WithChainUnaryInterceptor(chainUnaryInterceptors(d.options.unaryInterceptors())),
+		grpc.WithChainStreamInterceptor(chainStreamInterceptors(d.options.streamInterceptors())),
+	)
+
+	// the caller's options override the defaults
+	dialOpts = append(dialOpts, opts...)
+
+	// except for the stats handler, which can't be combined with another
+	if h := d.options.statsHandler(); h != nil {
+		dialOpts = append(dialOpts, grpc.WithStatsHandler(h))
+	}
+
+	var targets []string
+	for _, e := range d.options.endpoints {
+		if e.GRPCTarget != "" {
+			targets = append(targets, e.GRPCTarget)
+		}
+	}
+
+	if len(targets) == 0 {
+		return d.dialPool(ctx, d.options.grpcTarget, dialOpts)
+	}
+
+	conns := make([]GRPCv1Client, 0, len(targets))
+	for _, target := range targets {
+		conn, err := d.dialPool(ctx, target, dialOpts)
+		if err != nil {
+			_ = newGRPCv1Pool(conns).Close() // #nosec
+			return nil, err
+		}
+
+		conns = append(conns, conn)
+	}
+
+	return newGRPCv1Endpoints(d.options, conns), nil
+}
+
+// dialPool dials target, opening several connections if WithConnPoolSize was
+// used
+func (d grpcV1Dialer) dialPool(ctx context.Context, target string, dialOpts []grpc.DialOption) (GRPCv1Client, error) {
+	if d.options.connPoolSize <= 1 {
+		return d.dial(ctx, target, dialOpts)
+	}
+
+	conns := make([]GRPCv1Client, 0, d.options.connPoolSize)
+	for i := 0; i < d.options.connPoolSize; i++ {
+		conn, err := d.dial(ctx, target, dialOpts)
+		if err != nil {
+			_ = newGRPCv1Pool(conns).Close() // #nosec
+			return nil, err
+		}
+
+		conns = append(conns, conn)
+	}
+
+	return newGRPCv1Pool(conns), nil
+}
+
+func (d grpcV1Dialer) dial(ctx context.Context, target string, dialOpts []grpc.DialOption) (GRPCv1Client, error) {
+	if socket, ok := unixSocket(target); ok {
+		target = "passthrough:///" + socket
+		dialOpts = append(dialOpts[:len(dialOpts):len(dialOpts)], grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return d.options.dialContext(ctx, "unix", socket)
+		}))
+	} else if d.options.proxy != nil || d.options.dialer != nil {
+		dialOpts = append(dialOpts[:len(dialOpts):len(dialOpts)], grpc.WithContextDialer(d.contextDialer(grpcAuthority(target))))
+	}
+
+	conn, err := grpc.DialContext(ctx, target, dialOpts...)
 	if err != nil {
 		return nil, err
 	}
@@ -70,42 +181,59 @@ func (d grpcV1Dialer) Dial(ctx context.Context, opts ...grpc.DialOption) (GRPCv1
 	return grpcV1Client{
 		Closer:  conn,
 		client:  msg.NewAPIv1Client(conn),
+		conn:    conn,
 		options: d.options,
 	}, nil
 }
 
+// contextDialer returns the dialer used for the target at authority when a
+// proxy or dialer is configured. Since grpc only uses the proxy from the
+// environment without a custom dialer, it is applied here as well. Proxies are
+// sent a CONNECT request for authority rather than the resolved address.
+func (d grpcV1Dialer) contextDialer(authority string) func(context.Context, string) (net.Conn, error) {
+	return func(ctx context.Context, addr string) (net.Conn, error) {
+		p := d.options.proxy
+		if p == nil {
+			var err error
+			if p, err = envProxy(authority); err != nil {
+				return nil, err
+			}
+		}
+
+		if p == nil {
+			return d.options.dialContext(ctx, "tcp", addr)
+		}
+
+		dial, err := proxyDialer(p, d.options.dialContext, d.options.clientTLS())
+		if err != nil {
+			return nil, err
+		}
+
+		return dial(ctx, authority)
+	}
+}
+
 // NewGRPCv1 returns a properly configured GRPCv1Dialer
 func NewGRPCv1(ts oauth2.TokenSource, opts ...Option) GRPCv1Dialer {
 	o := defaults(ts)
 	for _, opt := range opts {
 		opt(o)
 	}
+	o.redactLog()
 
 	return grpcV1Dialer{options: o}
 }
 
 func (c grpcV1Client) Query(ctx context.Context, in *msg.QueryRequests, opts ...grpc.CallOption) (*msg.QueryReplies, error) {
-	zvelo.DebugContextOut(ctx, c.options.debug)
-	header, trailer, opts := grpcMD(opts...)
-	resp, err := c.client.Query(ctx, in, opts...)
-	zvelo.DebugMD(c.options.debug, *header, *trailer)
-	return resp, err
+	return c.client.Query(ctx, in, opts...)
 }
 
 func (c grpcV1Client) Result(ctx context.Context, in *msg.RequestID, opts ...grpc.CallOption) (*msg.QueryResult, error) {
-	zvelo.DebugContextOut(ctx, c.options.debug)
-	header, trailer, opts := grpcMD(opts...)
-	resp, err := c.client.Result(ctx, in, opts...)
-	zvelo.DebugMD(c.options.debug, *header, *trailer)
-	return resp, err
+	return c.client.Result(ctx, in, opts...)
 }
 
 func (c grpcV1Client) Suggest(ctx context.Context, in *msg.Suggestion, opts ...grpc.CallOption) (*empty.Empty, error) {
-	zvelo.DebugContextOut(ctx, c.options.debug)
-	header, trailer, opts := grpcMD(opts...)
-	resp, err := c.client.Suggest(ctx, in, opts...)
-	zvelo.DebugMD(c.options.debug, *header, *trailer)
-	return resp, err
+	return c.client.Suggest(ctx, in, opts...)
 }
 
 func (c grpcV1Client) Stream(ctx context.Context, in *empty.Empty, opts ...grpc.CallOption) (msg.APIv1_StreamClient, error) {
@@ -113,33 +241,65 @@ func (c grpcV1Client) Stream(ctx context.Context, in *empty.Empty, opts ...grpc.
 		in = &empty.Empty{}
 	}
 
-	zvelo.DebugContextOut(ctx, c.options.debug)
-	header, trailer, opts := grpcMD(opts...)
-	resp, err := c.client.Stream(ctx, in, opts...)
-	zvelo.DebugMD(c.options.debug, *header, *trailer)
-	return resp, err
+	return c.client.Stream(ctx, in, opts...)
+}
+
+func (c grpcV1Client) State() connectivity.State {
+	return c.conn.GetState()
 }
 
-func grpcMD(in ...grpc.CallOption) (header, trailer *metadata.MD, opts []grpc.CallOption) {
-	for _, o := range in {
-		if m, ok := o.(grpc.HeaderCallOption); ok {
-			header = m.HeaderAddr
+func (c grpcV1Client) WaitForReady(ctx context.Context) error {
+	for {
+		state := c.conn.GetState()
+
+		switch state {
+		case connectivity.Ready:
+			return nil
+		case connectivity.Shutdown:
+			return ErrConnShutdown
 		}
 
-		if m, ok := o.(grpc.TrailerCallOption); ok {
-			trailer = m.TrailerAddr
+		if !c.conn.WaitForStateChange(ctx, state) {
+			return ctx.Err()
 		}
 	}
+}
+
+func (c grpcV1Client) WatchState(ctx context.Context) <-chan connectivity.State {
+	ch := make(chan connectivity.State)
+
+	go func() {
+		defer close(ch)
+
+		state := c.conn.GetState()
+
+		for {
+			select {
+			case ch <- state:
+			case <-ctx.Done():
+				return
+			}
+
+			if state == connectivity.Shutdown || !c.conn.WaitForStateChange(ctx, state) {
+				return
+			}
+
+			state = c.conn.GetState()
+		}
+	}()
+
+	return ch
+}
 
-	if header == nil {
-		header = &metadata.MD{}
-		opts = append(opts, grpc.Header(header))
+// unixSocket returns the socket path of a unix:///path or unix:path target
+func unixSocket(target string) (string, bool) {
+	if strings.HasPrefix(target, "unix://") {
+		return strings.TrimPrefix(target, "unix://"), true
 	}
 
-	if trailer == nil {
-		trailer = &metadata.MD{}
-		opts = append(opts, grpc.Trailer(trailer))
+	if strings.HasPrefix(target, "unix:") {
+		return strings.TrimPrefix(target, "unix:"), true
 	}
 
-	return
+	return "", false
 }
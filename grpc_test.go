@@ -6,11 +6,15 @@ import (
 	"net"
 	"net/http"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 
 	"golang.org/x/oauth2"
 
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/keepalive"
 	"google.golang.org/grpc/metadata"
 
 	"zvelo.io/msg/mock"
@@ -180,3 +184,60 @@ func resultEqual(t *testing.T, result, expect *msg.QueryResult) {
 		t.Error("got unexpected result")
 	}
 }
+
+func TestConnectivity(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := grpc.NewServer()
+	go func() { _ = srv.Serve(lis) }()
+	defer srv.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client, err := NewGRPCv1(nil,
+		WithoutTLS(),
+		WithGrpcTarget(lis.Addr().String()),
+		WithKeepalive(keepalive.ClientParameters{Time: time.Minute}),
+	).Dial(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the server doesn't implement the api, but the call establishes the
+	// connection
+	_, _ = client.Result(ctx, &msg.RequestID{RequestId: "abc"})
+
+	if err = client.WaitForReady(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if s := client.State(); s != connectivity.Ready {
+		t.Errorf("expected READY, got %s", s)
+	}
+
+	watch := client.WatchState(ctx)
+	if s := <-watch; s != connectivity.Ready {
+		t.Errorf("expected READY, got %s", s)
+	}
+
+	if err = client.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var last connectivity.State
+	for s := range watch {
+		last = s
+	}
+
+	if last != connectivity.Shutdown {
+		t.Errorf("expected SHUTDOWN, got %s", last)
+	}
+
+	if err = client.WaitForReady(ctx); err != ErrConnShutdown {
+		t.Errorf("expected ErrConnShutdown, got: %v", err)
+	}
+}
@@ -0,0 +1,171 @@
+package zapi
+
+import (
+	"context"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"zvelo.io/go-zapi/internal/zvelo"
+	"zvelo.io/go-zapi/logger"
+)
+
+func (o options) unaryInterceptors() []grpc.UnaryClientInterceptor {
+	ret := []grpc.UnaryClientInterceptor{
+		tracingUnaryInterceptor(&o),
+		timeoutUnaryInterceptor(&o),
+	}
+
+	if o.retry != nil {
+		ret = append(ret, retryUnaryInterceptor(o.retry))
+	}
+
+	ret = append(ret, o.unary...)
+
+	return append(ret, debugUnaryInterceptor(o.log))
+}
+
+func (o options) streamInterceptors() []grpc.StreamClientInterceptor {
+	ret := []grpc.StreamClientInterceptor{tracingStreamInterceptor(&o)}
+
+	if o.streamIdleTimeout > 0 {
+		ret = append(ret, idleStreamInterceptor(o.streamIdleTimeout))
+	}
+
+	ret = append(ret, o.stream...)
+
+	return append(ret, debugStreamInterceptor(o.log))
+}
+
+// chainUnaryInterceptors returns a single interceptor that calls each of
+// interceptors in order
+func chainUnaryInterceptors(interceptors []grpc.UnaryClientInterceptor) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		next := invoker
+		for i := len(interceptors) - 1; i >= 0; i-- {
+			interceptor, inner := interceptors[i], next
+			next = func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+				return interceptor(ctx, method, req, reply, cc, inner, opts...)
+			}
+		}
+		return next(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// chainStreamInterceptors returns a single interceptor that calls each of
+// interceptors in order
+func chainStreamInterceptors(interceptors []grpc.StreamClientInterceptor) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		next := streamer
+		for i := len(interceptors) - 1; i >= 0; i-- {
+			interceptor, inner := interceptors[i], next
+			next = func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+				return interceptor(ctx, desc, cc, method, inner, opts...)
+			}
+		}
+		return next(ctx, desc, cc, method, opts...)
+	}
+}
+
+// grpcMD returns the header and trailer metadata that will be populated by
+// the call, adding CallOptions to capture them if they aren't already present
+func grpcMD(in ...grpc.CallOption) (header, trailer *metadata.MD, opts []grpc.CallOption) {
+	opts = in[:len(in):len(in)]
+
+	for _, o := range in {
+		if m, ok := o.(grpc.HeaderCallOption); ok {
+			header = m.HeaderAddr
+		}
+
+		if m, ok := o.(grpc.TrailerCallOption); ok {
+			trailer = m.TrailerAddr
+		}
+	}
+
+	if header == nil {
+		header = &metadata.MD{}
+		opts = append(opts, grpc.Header(header))
+	}
+
+	if trailer == nil {
+		trailer = &metadata.MD{}
+		opts = append(opts, grpc.Trailer(trailer))
+	}
+
+	return
+}
+
+func debugUnaryInterceptor(l logger.Logger) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		zvelo.DebugContextOut(ctx, l)
+		header, trailer, opts := grpcMD(opts...)
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		zvelo.DebugMD(l, *header, *trailer)
+		return err
+	}
+}
+
+func debugStreamInterceptor(l logger.Logger) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		zvelo.DebugContextOut(ctx, l)
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			return nil, err
+		}
+		return &debugClientStream{ClientStream: stream, log: l}, nil
+	}
+}
+
+// debugClientStream logs the header metadata when the first message is
+// received and the trailer metadata when the stream ends
+type debugClientStream struct {
+	grpc.ClientStream
+	log    logger.Logger
+	header bool
+}
+
+func (s *debugClientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+
+	if !s.header {
+		s.header = true
+		if md, herr := s.Header(); herr == nil {
+			zvelo.DebugMD(s.log, md)
+		}
+	}
+
+	if err != nil {
+		zvelo.DebugMD(s.log, s.Trailer())
+	}
+
+	return err
+}
+
+// retryUnaryInterceptor retries Result, and Query if permitted by p, calls
+// that fail with a retryable code
+func retryUnaryInterceptor(p *RetryPolicy) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		idempotent := strings.HasSuffix(method, "/Result") ||
+			(p.retryQuery() && strings.HasSuffix(method, "/Query"))
+
+		attempts := p.attempts(idempotent)
+		_, trailer, opts := grpcMD(opts...)
+
+		for attempt := 0; ; attempt++ {
+			err := invoker(ctx, method, req, reply, cc, opts...)
+			if err == nil || attempt+1 >= attempts || ctx.Err() != nil {
+				return err
+			}
+
+			if !p.retryCode(status.Code(err)) {
+				return err
+			}
+
+			if serr := sleep(ctx, p.delay(attempt, retryAfterMD(*trailer))); serr != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package zapi
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	msg "zvelo.io/msg/msgpb"
+)
+
+func TestInterceptors(t *testing.T) {
+	var calls []string
+
+	record := func(name string) grpc.UnaryClientInterceptor {
+		return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+			calls = append(calls, name)
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+	}
+
+	var o options
+	WithUnaryInterceptor(record("a"), record("b"))(&o)
+	WithRetry(RetryPolicy{MaxAttempts: 2, Backoff: Backoff{Initial: 1}})(&o)
+
+	interceptor := chainUnaryInterceptors(o.unaryInterceptors())
+
+	var trailer metadata.MD
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		calls = append(calls, "invoke")
+
+		if len(opts) != 2 {
+			t.Errorf("expected caller and header options, got: %v", opts)
+		}
+
+		return status.Error(codes.Unavailable, "unavailable")
+	}
+
+	err := interceptor(context.Background(), "/zvelo.msg.APIv1/Result", nil, nil, nil, invoker, grpc.Trailer(&trailer))
+	if status.Code(err) != codes.Unavailable {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	expect := []string{"a", "b", "invoke", "a", "b", "invoke"}
+	if len(calls) != len(expect) {
+		t.Fatalf("unexpected calls: %v", calls)
+	}
+
+	for i := range expect {
+		if calls[i] != expect[i] {
+			t.Errorf("unexpected calls: %v", calls)
+			break
+		}
+	}
+
+	// Suggest is never retried
+	calls = nil
+	_ = interceptor(context.Background(), "/zvelo.msg.APIv1/Suggest", nil, nil, nil, invoker, grpc.Trailer(&trailer))
+	if len(calls) != 3 {
+		t.Errorf("unexpected calls: %v", calls)
+	}
+}
+
+func TestDialInterceptor(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var attempts int32
+	srv := grpc.NewServer(grpc.UnknownServiceHandler(func(_ interface{}, stream grpc.ServerStream) error {
+		var in msg.RequestID
+		if err := stream.RecvMsg(&in); err != nil {
+			return err
+		}
+
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			return status.Error(codes.Unavailable, "unavailable")
+		}
+
+		return stream.SendMsg(&msg.QueryResult{RequestId: in.RequestId})
+	}))
+	go func() { _ = srv.Serve(lis) }()
+	defer srv.Stop()
+
+	var calls int
+	interceptor := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		calls++
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+
+	observer, observed := observations()
+
+	ctx := context.Background()
+	client, err := NewGRPCv1(nil,
+		WithoutTLS(),
+		WithGrpcTarget(lis.Addr().String()),
+		WithRetry(RetryPolicy{Backoff: Backoff{Initial: time.Millisecond}}),
+		WithObserver(observer),
+	).Dial(ctx, grpc.WithUnaryInterceptor(interceptor))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close() // #nosec
+
+	if _, err = client.Result(ctx, &msg.RequestID{RequestId: "abc"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if calls != 1 {
+		t.Errorf("expected the interceptor passed to Dial to be called once, got %d", calls)
+	}
+
+	if n := atomic.LoadInt32(&attempts); n != 2 {
+		t.Errorf("expected the call to be retried, got %d attempts", n)
+	}
+
+	select {
+	case <-observed:
+	case <-time.After(time.Second):
+		t.Error("expected the call to be observed")
+	}
+}
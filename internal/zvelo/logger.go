@@ -0,0 +1,328 @@
+package zvelo
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// A Level is the severity of a log entry
+type Level int
+
+// Levels, in increasing order of severity
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	}
+	return "level(" + strconv.Itoa(int(l)) + ")"
+}
+
+// A Logger records structured log entries. keyvals are alternating keys and
+// values. Implementations must be safe for concurrent use.
+type Logger interface {
+	Log(level Level, msg string, keyvals ...interface{})
+}
+
+// messages logged by the Debug functions and rendered specially by the color
+// logger
+const (
+	msgHTTPRequest  = "http request"
+	msgHTTPResponse = "http response"
+	msgMetadata     = "metadata"
+	msgTiming       = "timing"
+	msgSize         = "size"
+	msgMessageSize  = "message size"
+)
+
+// Enabled returns whether l logs entries at level. A Logger can implement
+// Enabled(Level) bool so that entries that would be dropped, e.g. HTTP dumps,
+// aren't built at all. Other Loggers are assumed to log every level.
+func Enabled(l Logger, level Level) bool {
+	if l == nil {
+		return false
+	}
+
+	if e, ok := l.(interface{ Enabled(Level) bool }); ok {
+		return e.Enabled(level)
+	}
+
+	return true
+}
+
+type discard struct{}
+
+func (discard) Log(Level, string, ...interface{}) {}
+func (discard) Enabled(Level) bool                { return false }
+
+// Discard is a Logger that does nothing
+var Discard Logger = discard{}
+
+type filter struct {
+	Logger
+	min Level
+}
+
+func (f filter) Log(level Level, msg string, keyvals ...interface{}) {
+	if level >= f.min {
+		f.Logger.Log(level, msg, keyvals...)
+	}
+}
+
+func (f filter) Enabled(level Level) bool {
+	return level >= f.min && Enabled(f.Logger, level)
+}
+
+// Filter returns a Logger that only passes entries of at least min level to l
+func Filter(l Logger, min Level) Logger {
+	return filter{Logger: l, min: min}
+}
+
+// syncWriter serializes writes of complete entries to w
+type syncWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (s *syncWriter) write(buf *bytes.Buffer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, _ = s.w.Write(buf.Bytes()) // #nosec
+}
+
+// fieldValue converts v to a value that is useful in structured output
+func fieldValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case nil, string, bool, int, int64, uint64, float64, json.Marshaler:
+		return t
+	case error:
+		return t.Error()
+	case time.Duration:
+		return t.String()
+	case fmt.Stringer:
+		return t.String()
+	}
+	return v
+}
+
+type jsonLogger struct {
+	syncWriter
+	now func() time.Time
+}
+
+// JSONLogger returns a Logger that writes each entry to w as a single line
+// JSON object with time, level and msg fields as well as the keyvals
+func JSONLogger(w io.Writer) Logger {
+	if w == nil {
+		return Discard
+	}
+
+	return &jsonLogger{
+		syncWriter: syncWriter{w: w},
+		now:        time.Now,
+	}
+}
+
+func (l *jsonLogger) Log(level Level, msg string, keyvals ...interface{}) {
+	entry := map[string]interface{}{
+		"time":  l.now().Format(time.RFC3339Nano),
+		"level": level.String(),
+		"msg":   msg,
+	}
+
+	for i := 0; i < len(keyvals); i += 2 {
+		var val interface{}
+		if i+1 < len(keyvals) {
+			val = keyvals[i+1]
+		}
+		entry[fmt.Sprint(keyvals[i])] = fieldValue(val)
+	}
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(entry); err != nil {
+		buf.Reset()
+		fmt.Fprintf(&buf, `{"level":"error","msg":%q}`+"\n", err.Error())
+	}
+
+	l.write(&buf)
+}
+
+type logfmtLogger struct {
+	syncWriter
+	now func() time.Time
+}
+
+// LogfmtLogger returns a Logger that writes each entry to w as a single line
+// of logfmt formatted key=value pairs
+func LogfmtLogger(w io.Writer) Logger {
+	if w == nil {
+		return Discard
+	}
+
+	return &logfmtLogger{
+		syncWriter: syncWriter{w: w},
+		now:        time.Now,
+	}
+}
+
+func logfmtValue(v interface{}) string {
+	var s string
+
+	switch t := fieldValue(v).(type) {
+	case nil:
+		return "null"
+	case string:
+		s = t
+	case bool, int, int64, uint64, float64:
+		s = fmt.Sprint(t)
+	default:
+		b, err := json.Marshal(t)
+		if err != nil {
+			s = fmt.Sprint(t)
+		} else {
+			s = string(b)
+		}
+	}
+
+	if s == "" || strings.ContainsAny(s, " =\"\\\n\t") {
+		return strconv.Quote(s)
+	}
+
+	return s
+}
+
+func (l *logfmtLogger) Log(level Level, msg string, keyvals ...interface{}) {
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "time=%s level=%s msg=%s",
+		l.now().Format(time.RFC3339Nano), level, logfmtValue(msg))
+
+	for i := 0; i < len(keyvals); i += 2 {
+		var val interface{}
+		if i+1 < len(keyvals) {
+			val = keyvals[i+1]
+		}
+		fmt.Fprintf(&buf, " %s=%s", fmt.Sprint(keyvals[i]), logfmtValue(val))
+	}
+
+	buf.WriteByte('\n')
+
+	l.write(&buf)
+}
+
+type colorLogger struct {
+	syncWriter
+}
+
+// ColorLogger returns a Logger that writes human readable, colorized output
+// to w. HTTP requests and responses are dumped in full.
+func ColorLogger(w io.Writer) Logger {
+	if w == nil {
+		return Discard
+	}
+
+	return &colorLogger{syncWriter: syncWriter{w: w}}
+}
+
+func field(keyvals []interface{}, key string) interface{} {
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		if keyvals[i] == key {
+			return keyvals[i+1]
+		}
+	}
+	return nil
+}
+
+func directionColor(keyvals []interface{}) (color.Attribute, string) {
+	if field(keyvals, "direction") == "out" {
+		return color.FgGreen, "> "
+	}
+	return color.FgYellow, "< "
+}
+
+func (l *colorLogger) Log(level Level, msg string, keyvals ...interface{}) {
+	var buf bytes.Buffer
+
+	if level >= LevelError {
+		write := color.New(color.FgRed).FprintfFunc()
+		write(&buf, "%s%s\n", msg, formatFields(keyvals))
+		l.write(&buf)
+		return
+	}
+
+	switch msg {
+	case msgHTTPRequest, msgHTTPResponse:
+		attr, prefix := directionColor(keyvals)
+		write := color.New(attr).FprintfFunc()
+		dump, _ := field(keyvals, "dump").(string)
+		for _, line := range strings.Split(dump, "\n") {
+			write(&buf, "%s%s\n", prefix, line)
+		}
+	case msgMetadata:
+		attr, prefix := directionColor(keyvals)
+		write := color.New(attr).FprintfFunc()
+		md, _ := field(keyvals, "metadata").(map[string][]string)
+		for _, k := range sortedKeys(md) {
+			for _, v := range md[k] {
+				write(&buf, "%s%s: %s\n", prefix, k, v)
+			}
+		}
+	case msgTiming:
+		write := color.New(color.FgBlue).FprintfFunc()
+		write(&buf, "* %s: %v\n", field(keyvals, "name"), field(keyvals, "duration"))
+	case msgSize:
+		write := color.New(color.FgBlue).FprintfFunc()
+		write(&buf, "* %s: %d bytes (%d bytes compressed)\n",
+			field(keyvals, "name"), field(keyvals, "size"), field(keyvals, "compressed"))
+	case msgMessageSize:
+		write := color.New(color.FgBlue).FprintfFunc()
+		write(&buf, "* %s: %d bytes (%d bytes on the wire)\n",
+			field(keyvals, "name"), field(keyvals, "size"), field(keyvals, "wire"))
+	default:
+		fmt.Fprintf(&buf, "%s%s\n", msg, formatFields(keyvals))
+	}
+
+	l.write(&buf)
+}
+
+func formatFields(keyvals []interface{}) string {
+	var buf bytes.Buffer
+	for i := 0; i < len(keyvals); i += 2 {
+		var val interface{}
+		if i+1 < len(keyvals) {
+			val = keyvals[i+1]
+		}
+		fmt.Fprintf(&buf, " %s=%s", fmt.Sprint(keyvals[i]), logfmtValue(val))
+	}
+	return buf.String()
+}
+
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
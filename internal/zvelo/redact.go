@@ -0,0 +1,211 @@
+package zvelo
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Redacted replaces the values that are removed from debug logs
+const Redacted = "REDACTED"
+
+// DefaultRedactHeaders are the HTTP headers and gRPC metadata keys whose
+// values are redacted by default
+var DefaultRedactHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	"Set-Cookie",
+}
+
+// DefaultRedactFields are the URL query, form and JSON fields whose values are
+// redacted by default. They cover the OAuth2 token endpoint and the
+// authorization code redirect.
+var DefaultRedactFields = []string{
+	"access_token",
+	"refresh_token",
+	"id_token",
+	"client_secret",
+	"code",
+	"code_verifier",
+	"password",
+	"assertion",
+	"client_assertion",
+}
+
+type redactor struct {
+	Logger
+	headers map[string]bool
+	fields  map[string]bool
+	json    *regexp.Regexp
+}
+
+// Redact returns a Logger that replaces the values of headers (case
+// insensitive) and fields in the HTTP dumps, URLs and metadata logged to l.
+// Fields are redacted from URL queries, form bodies and the string values of
+// JSON bodies.
+func Redact(l Logger, headers, fields []string) Logger {
+	if l == nil || l == Discard {
+		return Discard
+	}
+
+	r := redactor{
+		Logger:  l,
+		headers: map[string]bool{},
+		fields:  map[string]bool{},
+	}
+
+	for _, h := range headers {
+		r.headers[strings.ToLower(h)] = true
+	}
+
+	quoted := make([]string, 0, len(fields))
+	for _, f := range fields {
+		r.fields[f] = true
+		quoted = append(quoted, regexp.QuoteMeta(f))
+	}
+
+	if len(quoted) > 0 {
+		r.json = regexp.MustCompile(`("(?:` + strings.Join(quoted, "|") + `)"\s*:\s*)"(?:[^"\\]|\\.)*"`)
+	}
+
+	return r
+}
+
+func (r redactor) Log(level Level, msg string, keyvals ...interface{}) {
+	switch msg {
+	case msgHTTPRequest, msgHTTPResponse, msgMetadata:
+	default:
+		r.Logger.Log(level, msg, keyvals...)
+		return
+	}
+
+	kv := make([]interface{}, len(keyvals))
+	copy(kv, keyvals)
+
+	for i := 0; i+1 < len(kv); i += 2 {
+		switch v := kv[i+1].(type) {
+		case string:
+			switch kv[i] {
+			case "dump":
+				kv[i+1] = r.dump(v)
+			case "url":
+				kv[i+1] = r.url(v)
+			}
+		case map[string][]string:
+			if kv[i] == "metadata" {
+				kv[i+1] = r.metadata(v)
+			}
+		}
+	}
+
+	r.Logger.Log(level, msg, kv...)
+}
+
+// Enabled reports whether the wrapped Logger logs entries at level
+func (r redactor) Enabled(level Level) bool {
+	return Enabled(r.Logger, level)
+}
+
+// header returns the redacted value of header name
+func (r redactor) header(name, val string) string {
+	if !r.headers[strings.ToLower(name)] {
+		return val
+	}
+
+	// keep the authentication scheme, e.g. "Bearer", for debugging
+	if strings.HasSuffix(strings.ToLower(name), "authorization") {
+		if i := strings.IndexByte(val, ' '); i > 0 {
+			return val[:i+1] + Redacted
+		}
+	}
+
+	return Redacted
+}
+
+func (r redactor) metadata(md map[string][]string) map[string][]string {
+	ret := make(map[string][]string, len(md))
+	for k, vs := range md {
+		ret[k] = make([]string, len(vs))
+		for i, v := range vs {
+			ret[k][i] = r.header(k, v)
+		}
+	}
+	return ret
+}
+
+// query redacts the values of fields in a URL query or form body, preserving
+// the order and encoding of the other values
+func (r redactor) query(q string) string {
+	pairs := strings.Split(q, "&")
+	for i, pair := range pairs {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+
+		if key, err := url.QueryUnescape(kv[0]); err == nil && r.fields[key] {
+			pairs[i] = kv[0] + "=" + Redacted
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+func (r redactor) url(u string) string {
+	i := strings.IndexByte(u, '?')
+	if i < 0 {
+		return u
+	}
+
+	query, fragment := u[i+1:], ""
+	if j := strings.IndexByte(query, '#'); j >= 0 {
+		query, fragment = query[:j], query[j:]
+	}
+
+	return u[:i+1] + r.query(query) + fragment
+}
+
+// dump redacts an HTTP request or response as dumped by httputil
+func (r redactor) dump(dump string) string {
+	head, body := dump, ""
+	sep := "\r\n\r\n"
+	if i := strings.Index(dump, sep); i >= 0 {
+		head, body = dump[:i], dump[i+len(sep):]
+	} else {
+		sep = ""
+	}
+
+	lines := strings.Split(head, "\r\n")
+
+	// request line, e.g. "GET /path?query HTTP/1.1"
+	if parts := strings.SplitN(lines[0], " ", 3); len(parts) == 3 && !strings.HasPrefix(parts[0], "HTTP/") {
+		parts[1] = r.url(parts[1])
+		lines[0] = strings.Join(parts, " ")
+	}
+
+	var form bool
+	for i, line := range lines[1:] {
+		kv := strings.SplitN(line, ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+
+		val := strings.TrimSpace(kv[1])
+
+		if strings.EqualFold(kv[0], "Content-Type") && strings.HasPrefix(val, "application/x-www-form-urlencoded") {
+			form = true
+		}
+
+		if redacted := r.header(kv[0], val); redacted != val {
+			lines[i+1] = kv[0] + ": " + redacted
+		}
+	}
+
+	if form {
+		body = r.query(body)
+	} else if r.json != nil {
+		body = r.json.ReplaceAllString(body, `${1}"`+Redacted+`"`)
+	}
+
+	return strings.Join(lines, "\r\n") + sep + body
+}
@@ -4,7 +4,6 @@ import (
 	"context"
 	"crypto/rand"
 	"crypto/tls"
-	"io"
 	"math/big"
 	"net/http"
 	"net/http/httptrace"
@@ -14,17 +13,17 @@ import (
 	"sync"
 	"time"
 
-	"github.com/fatih/color"
 	"google.golang.org/grpc/metadata"
 )
 
-// DebugRequest logs incoming http.Requests to w
-func DebugRequest(w io.Writer, req *http.Request) {
-	debugHTTP(w, color.FgYellow, "< ", func() ([]byte, error) { return httputil.DumpRequest(req, true) })
+// DebugRequest logs incoming http.Requests to l
+func DebugRequest(l Logger, req *http.Request) {
+	debugHTTP(l, msgHTTPRequest, "in", func() ([]byte, error) { return httputil.DumpRequest(req, true) },
+		"method", req.Method, "url", req.URL.String())
 }
 
-// DebugRequestTiming logs http request timing to w
-func DebugRequestTiming(w io.Writer, req *http.Request) *http.Request {
+// DebugRequestTiming logs http request timing to l
+func DebugRequestTiming(l Logger, req *http.Request) *http.Request {
 	var start, dnsStart, connectStart, tlsStart, reqStart time.Time
 	var mu sync.Mutex
 
@@ -41,7 +40,7 @@ func DebugRequestTiming(w io.Writer, req *http.Request) *http.Request {
 		},
 		DNSDone: func(dnsInfo httptrace.DNSDoneInfo) {
 			mu.Lock()
-			DebugTiming(w, "DNS Lookup", time.Since(dnsStart))
+			DebugTiming(l, "DNS Lookup", time.Since(dnsStart))
 			mu.Unlock()
 		},
 		ConnectStart: func(network, addr string) {
@@ -51,7 +50,7 @@ func DebugRequestTiming(w io.Writer, req *http.Request) *http.Request {
 		},
 		ConnectDone: func(network, addr string, err error) {
 			mu.Lock()
-			DebugTiming(w, "TCP Connection", time.Since(connectStart))
+			DebugTiming(l, "TCP Connection", time.Since(connectStart))
 			mu.Unlock()
 		},
 		TLSHandshakeStart: func() {
@@ -61,7 +60,7 @@ func DebugRequestTiming(w io.Writer, req *http.Request) *http.Request {
 		},
 		TLSHandshakeDone: func(tls.ConnectionState, error) {
 			mu.Lock()
-			DebugTiming(w, "TLS Handshake", time.Since(tlsStart))
+			DebugTiming(l, "TLS Handshake", time.Since(tlsStart))
 			mu.Unlock()
 		},
 		WroteRequest: func(info httptrace.WroteRequestInfo) {
@@ -71,8 +70,8 @@ func DebugRequestTiming(w io.Writer, req *http.Request) *http.Request {
 		},
 		GotFirstResponseByte: func() {
 			mu.Lock()
-			DebugTiming(w, "Server Processing", time.Since(reqStart))
-			DebugTiming(w, "Total", time.Since(start))
+			DebugTiming(l, "Server Processing", time.Since(reqStart))
+			DebugTiming(l, "Total", time.Since(start))
 			mu.Unlock()
 		},
 	}
@@ -81,38 +80,38 @@ func DebugRequestTiming(w io.Writer, req *http.Request) *http.Request {
 	return req.WithContext(ctx)
 }
 
-// DebugRequestOut logs outgoing http.Requests to w
-func DebugRequestOut(w io.Writer, req *http.Request) {
-	debugHTTP(w, color.FgGreen, "> ", func() ([]byte, error) { return httputil.DumpRequestOut(req, true) })
+// DebugRequestOut logs outgoing http.Requests to l
+func DebugRequestOut(l Logger, req *http.Request) {
+	debugHTTP(l, msgHTTPRequest, "out", func() ([]byte, error) { return httputil.DumpRequestOut(req, true) },
+		"method", req.Method, "url", req.URL.String())
 }
 
-// DebugResponse logs received http.Responses to w
-func DebugResponse(w io.Writer, resp *http.Response, body bool) {
-	debugHTTP(w, color.FgYellow, "< ", func() ([]byte, error) { return httputil.DumpResponse(resp, body) })
+// DebugResponse logs received http.Responses to l
+func DebugResponse(l Logger, resp *http.Response, body bool) {
+	if resp == nil {
+		return
+	}
 
-	if resp != nil {
-		if dur, ok := upstreamDur(resp.Header); ok {
-			DebugTiming(w, "Upstream Processing", dur)
-		}
+	debugHTTP(l, msgHTTPResponse, "in", func() ([]byte, error) { return httputil.DumpResponse(resp, body) },
+		"status", resp.StatusCode)
+
+	if dur, ok := upstreamDur(resp.Header); ok {
+		DebugTiming(l, "Upstream Processing", dur)
 	}
 }
 
-func debugHTTP(w io.Writer, attr color.Attribute, prefix string, fn func() ([]byte, error)) {
-	if w == nil {
+func debugHTTP(l Logger, msg, direction string, fn func() ([]byte, error), keyvals ...interface{}) {
+	if !Enabled(l, LevelDebug) {
 		return
 	}
 
 	dump, err := fn()
 	if err != nil {
-		_, _ = color.New(color.FgRed).Fprintf(w, "%s\n", err) // #nosec
+		l.Log(LevelError, "debug dump failed", "error", err)
 		return
 	}
 
-	write := color.New(attr).FprintfFunc()
-	parts := strings.Split(string(dump), "\n")
-	for _, line := range parts {
-		write(w, "%s%s\n", prefix, line)
-	}
+	l.Log(LevelDebug, msg, append([]interface{}{"direction", direction}, append(keyvals, "dump", string(dump))...)...)
 }
 
 var chars = []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789")
@@ -130,29 +129,51 @@ func RandString(n int) string {
 	return string(b)
 }
 
-// DebugHandler returns an http.Handler that debugs incoming requests to w. next
-// is called after writing to the debug writer.
-func DebugHandler(w io.Writer, next http.Handler) http.Handler {
+// DebugHandler returns an http.Handler that debugs incoming requests to l.
+// next is called after logging the request.
+func DebugHandler(l Logger, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
-		DebugRequest(w, req)
+		DebugRequest(l, req)
 		next.ServeHTTP(rw, req)
 	})
 }
 
-// DebugContextOut logs outgoing metadata headers to w
-func DebugContextOut(ctx context.Context, w io.Writer) {
+// DebugContextOut logs outgoing metadata headers to l
+func DebugContextOut(ctx context.Context, l Logger) {
 	md, ok := metadata.FromOutgoingContext(ctx)
 	if !ok {
 		return
 	}
 
-	debugMD(w, color.FgGreen, "> ", md)
+	debugMD(l, "out", md)
 }
 
-// DebugTiming logs timing information to w
-func DebugTiming(w io.Writer, name string, dur time.Duration) {
-	write := color.New(color.FgBlue).FprintfFunc()
-	write(w, "* %s: %v\n", name, dur)
+// DebugTiming logs timing information to l
+func DebugTiming(l Logger, name string, dur time.Duration) {
+	if l == nil {
+		return
+	}
+
+	l.Log(LevelDebug, msgTiming, "name", name, "duration", dur)
+}
+
+// DebugSize logs the uncompressed and compressed size of a message body to l
+func DebugSize(l Logger, name string, size, compressed int64) {
+	if l == nil {
+		return
+	}
+
+	l.Log(LevelDebug, msgSize, "name", name, "size", size, "compressed", compressed)
+}
+
+// DebugMessageSize logs the size of a gRPC message and the number of bytes
+// it occupied on the wire after compression
+func DebugMessageSize(l Logger, name string, size, wire int64) {
+	if l == nil {
+		return
+	}
+
+	l.Log(LevelDebug, msgMessageSize, "name", name, "size", size, "wire", wire)
 }
 
 func upstreamDur(header map[string][]string) (time.Duration, bool) {
@@ -178,27 +199,21 @@ func upstreamDur(header map[string][]string) (time.Duration, bool) {
 	return time.Duration(i) * time.Millisecond, true
 }
 
-// DebugMD logs received metadata headers to w
-func DebugMD(w io.Writer, mds ...metadata.MD) {
+// DebugMD logs received metadata headers to l
+func DebugMD(l Logger, mds ...metadata.MD) {
 	for _, md := range mds {
-		debugMD(w, color.FgYellow, "< ", md)
+		debugMD(l, "in", md)
 
 		if dur, ok := upstreamDur(md); ok {
-			DebugTiming(w, "Upstream Processing", dur)
+			DebugTiming(l, "Upstream Processing", dur)
 		}
 	}
 }
 
-func debugMD(w io.Writer, attr color.Attribute, prefix string, md metadata.MD) {
-	if w == nil {
+func debugMD(l Logger, direction string, md metadata.MD) {
+	if l == nil || len(md) == 0 {
 		return
 	}
 
-	write := color.New(attr).FprintfFunc()
-
-	for k, vs := range md {
-		for _, v := range vs {
-			write(w, "%s%s: %s\n", prefix, k, v)
-		}
-	}
+	l.Log(LevelDebug, msgMetadata, "direction", direction, "metadata", map[string][]string(md))
 }
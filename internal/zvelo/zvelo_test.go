@@ -9,9 +9,10 @@ import (
 
 func TestDebug(t *testing.T) {
 	var buf bytes.Buffer
+	l := ColorLogger(&buf)
 
 	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		DebugRequest(&buf, r)
+		DebugRequest(l, r)
 	}))
 
 	req, err := http.NewRequest("GET", s.URL, nil)
@@ -19,7 +20,7 @@ func TestDebug(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	DebugRequestOut(&buf, req)
+	DebugRequestOut(l, req)
 
 	if buf.Len() == 0 {
 		t.Error("DebugRequestOut didn't write any data")
@@ -38,13 +39,32 @@ func TestDebug(t *testing.T) {
 
 	buf.Reset()
 
-	DebugResponse(&buf, resp, true)
+	DebugResponse(l, resp, true)
 
 	if buf.Len() == 0 {
 		t.Error("DebugResponse didn't write any data")
 	}
 }
 
+func TestDebugFiltered(t *testing.T) {
+	var buf bytes.Buffer
+	l := Redact(Filter(ColorLogger(&buf), LevelInfo), nil, nil)
+
+	if Enabled(l, LevelDebug) || !Enabled(l, LevelInfo) {
+		t.Error("expected only info and above to be enabled")
+	}
+
+	var dumped bool
+	debugHTTP(l, msgHTTPRequest, "out", func() ([]byte, error) {
+		dumped = true
+		return nil, nil
+	})
+
+	if dumped || buf.Len() != 0 {
+		t.Error("expected the dump to be skipped")
+	}
+}
+
 func TestRandString(t *testing.T) {
 	val0 := RandString(32)
 	if len(val0) != 32 {
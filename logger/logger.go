@@ -0,0 +1,84 @@
+// Package logger provides the structured Logger used by the zapi clients,
+// callback.Middleware, userauth and tokensource to emit debug information
+package logger // import "zvelo.io/go-zapi/logger"
+
+import (
+	"io"
+
+	"zvelo.io/go-zapi/internal/zvelo"
+)
+
+// A Level is the severity of a log entry
+type Level = zvelo.Level
+
+// Levels, in increasing order of severity
+const (
+	Debug = zvelo.LevelDebug
+	Info  = zvelo.LevelInfo
+	Warn  = zvelo.LevelWarn
+	Error = zvelo.LevelError
+)
+
+// A Logger records structured log entries. keyvals are alternating keys and
+// values. Implementations must be safe for concurrent use.
+type Logger = zvelo.Logger
+
+// Discard is a Logger that does nothing
+var Discard = zvelo.Discard
+
+// JSON returns a Logger that writes each entry to w as a single line JSON
+// object with time, level and msg fields as well as the keyvals
+func JSON(w io.Writer) Logger {
+	return zvelo.JSONLogger(w)
+}
+
+// Logfmt returns a Logger that writes each entry to w as a single line of
+// logfmt formatted key=value pairs
+func Logfmt(w io.Writer) Logger {
+	return zvelo.LogfmtLogger(w)
+}
+
+// Color returns a Logger that writes human readable, colorized output to w,
+// including full dumps of HTTP requests and responses. This is the output
+// produced by the WithDebug Options.
+func Color(w io.Writer) Logger {
+	return zvelo.ColorLogger(w)
+}
+
+// Filter returns a Logger that only passes entries of at least min level to l
+func Filter(l Logger, min Level) Logger {
+	return zvelo.Filter(l, min)
+}
+
+// Enabled returns whether l logs entries at level. A Logger can implement
+// Enabled(Level) bool so that entries that would be dropped, e.g. HTTP dumps,
+// aren't built at all. Other Loggers are assumed to log every level.
+func Enabled(l Logger, level Level) bool {
+	return zvelo.Enabled(l, level)
+}
+
+// DefaultRedactHeaders are the HTTP headers and gRPC metadata keys that are
+// redacted from debug logs by default
+var DefaultRedactHeaders = zvelo.DefaultRedactHeaders
+
+// DefaultRedactFields are the URL query, form and JSON fields that are
+// redacted from debug logs by default, e.g. access_token and client_secret
+var DefaultRedactFields = zvelo.DefaultRedactFields
+
+// Redact returns a Logger that replaces the values of headers and fields in
+// the HTTP dumps, URLs and gRPC metadata logged to l with "REDACTED". Only
+// the given headers and fields are redacted, include DefaultRedactHeaders and
+// DefaultRedactFields to extend the defaults.
+func Redact(l Logger, headers, fields []string) Logger {
+	return zvelo.Redact(l, headers, fields)
+}
+
+// RedactDefaults returns a Logger that redacts DefaultRedactHeaders and
+// DefaultRedactFields as well as the additional headers and fields from the
+// entries logged to l
+func RedactDefaults(l Logger, headers, fields []string) Logger {
+	return Redact(l,
+		append(append([]string{}, DefaultRedactHeaders...), headers...),
+		append(append([]string{}, DefaultRedactFields...), fields...),
+	)
+}
@@ -0,0 +1,82 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJSON(t *testing.T) {
+	var buf bytes.Buffer
+
+	JSON(&buf).Log(Warn, "token", "duration", 2*time.Second, "error", errors.New("expired"), "size", 12)
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := map[string]interface{}{
+		"level":    "warn",
+		"msg":      "token",
+		"duration": "2s",
+		"error":    "expired",
+		"size":     float64(12),
+	}
+
+	for k, v := range expect {
+		if entry[k] != v {
+			t.Errorf("expected %s=%v, got %v", k, v, entry[k])
+		}
+	}
+
+	if _, ok := entry["time"]; !ok {
+		t.Error("expected time field")
+	}
+}
+
+func TestLogfmt(t *testing.T) {
+	var buf bytes.Buffer
+
+	Logfmt(&buf).Log(Debug, "http request", "url", "http://example.com", "header", map[string][]string{"A": {"b c"}})
+
+	line := buf.String()
+	for _, s := range []string{" level=debug ", ` msg="http request" `, " url=http://example.com ", ` header="{\"A\":[\"b c\"]}"`} {
+		if !strings.Contains(line, s) {
+			t.Errorf("expected %q in %q", s, line)
+		}
+	}
+
+	if !strings.HasPrefix(line, "time=") || !strings.HasSuffix(line, "\n") {
+		t.Errorf("unexpected line: %q", line)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	var buf bytes.Buffer
+
+	l := Filter(Logfmt(&buf), Info)
+	l.Log(Debug, "dropped")
+	l.Log(Error, "kept")
+
+	if strings.Contains(buf.String(), "dropped") || !strings.Contains(buf.String(), "msg=kept") {
+		t.Errorf("unexpected output: %q", buf.String())
+	}
+}
+
+func TestColor(t *testing.T) {
+	var buf bytes.Buffer
+
+	Color(&buf).Log(Debug, "timing", "name", "Token", "duration", time.Second)
+
+	if !strings.Contains(buf.String(), "* Token: 1s") {
+		t.Errorf("unexpected output: %q", buf.String())
+	}
+
+	if Color(nil) != Discard {
+		t.Error("expected Discard for nil writer")
+	}
+}
@@ -0,0 +1,63 @@
+package metrics
+
+import (
+	"expvar"
+	"sync"
+)
+
+// ExpvarName is the name under which the Observer returned by Expvar publishes
+// its variables
+const ExpvarName = "zapi"
+
+var (
+	expvarOnce     sync.Once
+	expvarObserver Observer
+)
+
+// Expvar returns an Observer that publishes its counters with the expvar
+// package as ExpvarName. Every call returns the same Observer.
+func Expvar() Observer {
+	expvarOnce.Do(func() {
+		expvarObserver = NewExpvar(expvar.NewMap(ExpvarName))
+	})
+	return expvarObserver
+}
+
+type expvarMap struct {
+	mu   sync.Mutex
+	vars *expvar.Map
+}
+
+// NewExpvar returns an Observer that records to vars. For every transport and
+// method, e.g. "grpc.Query", vars holds a map with the number of calls, the
+// number of calls per status code, the total duration in nanoseconds and the
+// total bytes sent and received.
+func NewExpvar(vars *expvar.Map) Observer {
+	return &expvarMap{vars: vars}
+}
+
+func (m *expvarMap) call(key string) *expvar.Map {
+	if v, ok := m.vars.Get(key).(*expvar.Map); ok {
+		return v
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if v, ok := m.vars.Get(key).(*expvar.Map); ok {
+		return v
+	}
+
+	v := new(expvar.Map).Init()
+	m.vars.Set(key, v)
+	return v
+}
+
+func (m *expvarMap) Observe(o Observation) {
+	v := m.call(string(o.Transport) + "." + o.Method)
+	v.Add("calls", 1)
+	v.Add("code."+o.Code.String(), 1)
+	v.Add("duration_ns", int64(o.Duration))
+	v.Add("bytes_sent", o.BytesSent)
+	v.Add("bytes_received", o.BytesReceived)
+}
@@ -0,0 +1,114 @@
+// Package metrics provides the Observer that the zapi clients,
+// callback.Middleware and tokensource call to record the outcome of each call
+// to or from zveloAPI
+package metrics // import "zvelo.io/go-zapi/metrics"
+
+import (
+	"net/http"
+	"time"
+
+	"google.golang.org/grpc/codes"
+)
+
+// A Transport identifies how a call was made
+type Transport string
+
+// Transports reported in Observations
+const (
+	REST     Transport = "rest"
+	GRPC     Transport = "grpc"
+	Callback Transport = "callback"
+	OAuth2   Transport = "oauth2"
+)
+
+// An Observation describes a single completed call
+type Observation struct {
+	// Method is the name of the call, e.g. "Query", "Stream", "Callback" or
+	// "Token"
+	Method string
+
+	Transport Transport
+
+	// Code is the gRPC status code of the call. For HTTP calls it is derived
+	// from HTTPStatus, or from the error if no response was received.
+	Code codes.Code
+
+	// HTTPStatus is the HTTP status code of REST, callback and token calls. It
+	// is 0 for gRPC calls and when no response was received.
+	HTTPStatus int
+
+	// Duration is the time from the start of the call until its response was
+	// completely read. For streams it is the lifetime of the stream.
+	Duration time.Duration
+
+	// BytesSent and BytesReceived are the sizes of the request and response
+	// bodies or messages as sent on the wire, i.e. after compression
+	BytesSent     int64
+	BytesReceived int64
+}
+
+// An Observer records Observations. Implementations must be safe for
+// concurrent use and should not block.
+type Observer interface {
+	Observe(Observation)
+}
+
+// The ObserverFunc type is an adapter to allow the use of ordinary functions
+// as Observers
+type ObserverFunc func(Observation)
+
+// Observe calls f(o)
+func (f ObserverFunc) Observe(o Observation) {
+	f(o)
+}
+
+type discard struct{}
+
+func (discard) Observe(Observation) {}
+
+// Discard is an Observer that does nothing
+var Discard Observer = discard{}
+
+// HTTPCode returns the gRPC status code that corresponds to an HTTP status
+// code, the inverse of the mapping used by zveloAPI
+func HTTPCode(status int) codes.Code {
+	switch status {
+	case http.StatusOK:
+		return codes.OK
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.Aborted
+	case http.StatusPreconditionFailed:
+		return codes.FailedPrecondition
+	case http.StatusRequestedRangeNotSatisfiable:
+		return codes.OutOfRange
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case 499:
+		return codes.Canceled
+	case http.StatusNotImplemented:
+		return codes.Unimplemented
+	case http.StatusServiceUnavailable:
+		return codes.Unavailable
+	case http.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
+	}
+
+	switch {
+	case status >= 200 && status < 300:
+		return codes.OK
+	case status >= 400 && status < 500:
+		return codes.FailedPrecondition
+	case status >= 500:
+		return codes.Internal
+	}
+
+	return codes.Unknown
+}
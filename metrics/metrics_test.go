@@ -0,0 +1,57 @@
+package metrics
+
+import (
+	"expvar"
+	"net/http"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+)
+
+func TestExpvar(t *testing.T) {
+	vars := new(expvar.Map).Init()
+	o := NewExpvar(vars)
+
+	o.Observe(Observation{Method: "Query", Transport: GRPC, Duration: time.Second, BytesSent: 10, BytesReceived: 20})
+	o.Observe(Observation{Method: "Query", Transport: GRPC, Code: codes.Unavailable, Duration: time.Second})
+
+	call, ok := vars.Get("grpc.Query").(*expvar.Map)
+	if !ok {
+		t.Fatalf("missing grpc.Query: %s", vars)
+	}
+
+	expect := map[string]string{
+		"calls":            "2",
+		"code.OK":          "1",
+		"code.Unavailable": "1",
+		"duration_ns":      "2000000000",
+		"bytes_sent":       "10",
+		"bytes_received":   "20",
+	}
+
+	for k, v := range expect {
+		if got := call.Get(k); got == nil || got.String() != v {
+			t.Errorf("expected %s=%s, got %v", k, v, got)
+		}
+	}
+
+	if Expvar() != Expvar() || expvar.Get(ExpvarName) == nil {
+		t.Error("expected Expvar to publish a single Observer")
+	}
+}
+
+func TestHTTPCode(t *testing.T) {
+	for status, code := range map[int]codes.Code{
+		http.StatusOK:                  codes.OK,
+		http.StatusNoContent:           codes.OK,
+		http.StatusUnauthorized:        codes.Unauthenticated,
+		http.StatusTeapot:              codes.FailedPrecondition,
+		http.StatusServiceUnavailable:  codes.Unavailable,
+		http.StatusInternalServerError: codes.Internal,
+	} {
+		if got := HTTPCode(status); got != code {
+			t.Errorf("HTTPCode(%d): expected %s, got %s", status, code, got)
+		}
+	}
+}
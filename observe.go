@@ -0,0 +1,226 @@
+package zapi
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/stats"
+	"google.golang.org/grpc/status"
+
+	"zvelo.io/go-zapi/logger"
+	"zvelo.io/go-zapi/metrics"
+)
+
+// WithObserver returns an Option that causes both clients to report every
+// call to val. REST calls are reported once per HTTP request, i.e. once per
+// attempt when retries are enabled. Streams are reported when they end.
+func WithObserver(val metrics.Observer) Option {
+	if val == nil {
+		val = metrics.Discard
+	}
+
+	return func(o *options) {
+		o.observer = val
+	}
+}
+
+// withMethod records the Method of a REST call in ctx for the transport
+func withMethod(ctx context.Context, m Method) context.Context {
+	return context.WithValue(ctx, methodKey, m)
+}
+
+// errCode returns the status code of a call that failed with err
+func errCode(ctx context.Context, err error) codes.Code {
+	switch ctx.Err() {
+	case context.Canceled:
+		return codes.Canceled
+	case context.DeadlineExceeded:
+		return codes.DeadlineExceeded
+	}
+
+	return status.Code(err)
+}
+
+// observe reports a REST request that didn't receive a response
+func (t *transport) observe(req *http.Request, start time.Time, err error) {
+	m, _ := req.Context().Value(methodKey).(Method)
+
+	t.observer.Observe(metrics.Observation{
+		Method:    string(m),
+		Transport: metrics.REST,
+		Code:      errCode(req.Context(), err),
+		Duration:  time.Since(start),
+		BytesSent: contentLength(req.ContentLength),
+	})
+}
+
+// observeBody replaces the body of res so that the request is reported once
+// the body has been read or closed
+func (t *transport) observeBody(req *http.Request, res *http.Response, start time.Time) {
+	m, _ := req.Context().Value(methodKey).(Method)
+
+	o := metrics.Observation{
+		Method:     string(m),
+		Transport:  metrics.REST,
+		Code:       metrics.HTTPCode(res.StatusCode),
+		HTTPStatus: res.StatusCode,
+		BytesSent:  contentLength(req.ContentLength),
+	}
+
+	res.Body = &observedBody{
+		ReadCloser: res.Body,
+		done: func(n int64) {
+			o.Duration = time.Since(start)
+			o.BytesReceived = n
+			t.observer.Observe(o)
+		},
+	}
+}
+
+func contentLength(n int64) int64 {
+	if n < 0 {
+		return 0
+	}
+	return n
+}
+
+// observedBody counts the bytes read and calls done when the body is read to
+// the end, fails or is closed
+type observedBody struct {
+	io.ReadCloser
+	n    int64
+	once sync.Once
+	done func(n int64)
+}
+
+func (b *observedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+
+	if err != nil {
+		b.once.Do(func() { b.done(b.n) })
+	}
+
+	return n, err
+}
+
+func (b *observedBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() { b.done(b.n) })
+	return err
+}
+
+type rpcStatsKey struct{}
+
+// rpcStats accumulates the stats of a single gRPC call
+type rpcStats struct {
+	method      Method
+	sent, recvd int64
+	begin       time.Time
+}
+
+// WithStatsHandler returns an Option that causes val to be called for every
+// gRPC call made by the GRPCv1Client, along with the built-in handlers. Use it
+// instead of grpc.WithStatsHandler, which would be overridden.
+func WithStatsHandler(val stats.Handler) Option {
+	return func(o *options) {
+		o.statsHandlers = append(o.statsHandlers, val)
+	}
+}
+
+// metricsStatsHandler reports every gRPC call to an Observer
+type metricsStatsHandler struct {
+	observer metrics.Observer
+}
+
+func (h metricsStatsHandler) TagRPC(ctx context.Context, info *stats.RPCTagInfo) context.Context {
+	return context.WithValue(ctx, rpcStatsKey{}, &rpcStats{method: grpcMethod(info.FullMethodName)})
+}
+
+func (h metricsStatsHandler) HandleRPC(ctx context.Context, s stats.RPCStats) {
+	r, ok := ctx.Value(rpcStatsKey{}).(*rpcStats)
+	if !ok {
+		return
+	}
+
+	switch p := s.(type) {
+	case *stats.Begin:
+		r.begin = p.BeginTime
+	case *stats.OutPayload:
+		atomic.AddInt64(&r.sent, int64(p.WireLength-grpcFrameHeaderLen))
+	case *stats.InPayload:
+		atomic.AddInt64(&r.recvd, int64(p.WireLength-grpcFrameHeaderLen))
+	case *stats.End:
+		h.observer.Observe(metrics.Observation{
+			Method:        string(r.method),
+			Transport:     metrics.GRPC,
+			Code:          status.Code(p.Error),
+			Duration:      p.EndTime.Sub(r.begin),
+			BytesSent:     atomic.LoadInt64(&r.sent),
+			BytesReceived: atomic.LoadInt64(&r.recvd),
+		})
+	}
+}
+
+func (h metricsStatsHandler) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (h metricsStatsHandler) HandleConn(context.Context, stats.ConnStats) {}
+
+// statsHandler returns the stats.Handler that logs message sizes, reports
+// calls to the observer and calls those added with WithStatsHandler. It returns
+// nil if none of them are enabled.
+func (o *options) statsHandler() stats.Handler {
+	var hs statsHandlers
+
+	if logger.Enabled(o.log, logger.Debug) {
+		hs = append(hs, debugStatsHandler{log: o.log})
+	}
+
+	if o.observer != metrics.Discard {
+		hs = append(hs, metricsStatsHandler{observer: o.observer})
+	}
+
+	hs = append(hs, o.statsHandlers...)
+
+	if len(hs) == 0 {
+		return nil
+	}
+
+	return hs
+}
+
+// statsHandlers calls each of its handlers in order
+type statsHandlers []stats.Handler
+
+func (hs statsHandlers) TagRPC(ctx context.Context, info *stats.RPCTagInfo) context.Context {
+	for _, h := range hs {
+		ctx = h.TagRPC(ctx, info)
+	}
+	return ctx
+}
+
+func (hs statsHandlers) HandleRPC(ctx context.Context, s stats.RPCStats) {
+	for _, h := range hs {
+		h.HandleRPC(ctx, s)
+	}
+}
+
+func (hs statsHandlers) TagConn(ctx context.Context, info *stats.ConnTagInfo) context.Context {
+	for _, h := range hs {
+		ctx = h.TagConn(ctx, info)
+	}
+	return ctx
+}
+
+func (hs statsHandlers) HandleConn(ctx context.Context, s stats.ConnStats) {
+	for _, h := range hs {
+		h.HandleConn(ctx, s)
+	}
+}
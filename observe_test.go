@@ -0,0 +1,141 @@
+package zapi
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"zvelo.io/go-zapi/metrics"
+	msg "zvelo.io/msg/msgpb"
+)
+
+func observations() (metrics.Observer, <-chan metrics.Observation) {
+	ch := make(chan metrics.Observation, 10)
+	return metrics.ObserverFunc(func(o metrics.Observation) { ch <- o }), ch
+}
+
+func TestRESTObserver(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/query/missing" {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", contentTypeJSON)
+		_, _ = w.Write([]byte(`{"requestId":"abc"}`)) // #nosec
+	}))
+	defer srv.Close()
+
+	observer, ch := observations()
+
+	client := NewRESTv1(nil, WithRestBaseURL(srv.URL), WithObserver(observer))
+
+	ctx := context.Background()
+	if _, err := client.Result(ctx, "abc"); err != nil {
+		t.Fatal(err)
+	}
+
+	o := <-ch
+	if o.Method != "Result" || o.Transport != metrics.REST || o.Code != codes.OK ||
+		o.HTTPStatus != http.StatusOK || o.BytesReceived != 19 || o.Duration <= 0 {
+		t.Errorf("unexpected observation: %+v", o)
+	}
+
+	if _, err := client.Result(ctx, "missing"); err == nil {
+		t.Fatal("expected error")
+	}
+
+	if o = <-ch; o.Code != codes.NotFound || o.HTTPStatus != http.StatusNotFound {
+		t.Errorf("unexpected observation: %+v", o)
+	}
+
+	if err := client.Suggest(ctx, &msg.Suggestion{Url: "http://example.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if o = <-ch; o.Method != "Suggest" || o.BytesSent == 0 {
+		t.Errorf("unexpected observation: %+v", o)
+	}
+}
+
+func TestGRPCObserver(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := grpc.NewServer(grpc.UnknownServiceHandler(func(_ interface{}, stream grpc.ServerStream) error {
+		var in msg.RequestID
+		if err := stream.RecvMsg(&in); err != nil {
+			return err
+		}
+
+		if in.RequestId == "missing" {
+			return status.Error(codes.NotFound, "not found")
+		}
+
+		return stream.SendMsg(&msg.QueryResult{RequestId: in.RequestId})
+	}))
+	go func() { _ = srv.Serve(lis) }()
+	defer srv.Stop()
+
+	observer, ch := observations()
+
+	ctx := context.Background()
+	client, err := NewGRPCv1(nil,
+		WithoutTLS(),
+		WithGrpcTarget(lis.Addr().String()),
+		WithObserver(observer),
+	).Dial(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close() // #nosec
+
+	if _, err = client.Result(ctx, &msg.RequestID{RequestId: "abc"}); err != nil {
+		t.Fatal(err)
+	}
+
+	o := <-ch
+	if o.Method != "Result" || o.Transport != metrics.GRPC || o.Code != codes.OK ||
+		o.BytesSent != 5 || o.BytesReceived != 5 || o.Duration <= 0 {
+		t.Errorf("unexpected observation: %+v", o)
+	}
+
+	if _, err = client.Result(ctx, &msg.RequestID{RequestId: "missing"}); status.Code(err) != codes.NotFound {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if o = <-ch; o.Code != codes.NotFound {
+		t.Errorf("unexpected observation: %+v", o)
+	}
+}
+
+func TestStatsHandler(t *testing.T) {
+	o := defaults(nil)
+	if h := o.statsHandler(); h != nil {
+		t.Errorf("expected no stats handler by default, got: %v", h)
+	}
+
+	WithDebug(ioutil.Discard)(o)
+	if hs, ok := o.statsHandler().(statsHandlers); !ok || len(hs) != 1 {
+		t.Errorf("expected only the debug stats handler, got: %v", hs)
+	}
+
+	observer, _ := observations()
+	WithObserver(observer)(o)
+	if hs, ok := o.statsHandler().(statsHandlers); !ok || len(hs) != 2 {
+		t.Errorf("expected debug and metrics stats handlers, got: %v", hs)
+	}
+
+	WithStatsHandler(make(payloadSizes))(o)
+	if hs, ok := o.statsHandler().(statsHandlers); !ok || len(hs) != 3 {
+		t.Errorf("expected the added stats handler, got: %v", hs)
+	}
+}
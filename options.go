@@ -1,15 +1,28 @@
 package zapi
 
 import (
+	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"io"
-	"io/ioutil"
+	"net"
 	"net/http"
 	"net/url"
 	"path"
 	"strings"
+	"time"
+
+	"github.com/pkg/errors"
 
 	"golang.org/x/oauth2"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/stats"
+
+	"zvelo.io/go-zapi/logger"
+	"zvelo.io/go-zapi/metrics"
+	"zvelo.io/go-zapi/tracing"
 )
 
 // UserAgent is the user agent that will be provided by the RESTv1Client. It can
@@ -29,11 +42,37 @@ type options struct {
 	oauth2.TokenSource
 	grpcTarget            string
 	restBaseURL           *url.URL
-	debug                 io.Writer
+	log                   logger.Logger
 	noHTTP2               bool
 	transport             http.RoundTripper
 	tlsInsecureSkipVerify bool
+	tlsConfig             *tls.Config
 	withoutTLS            bool
+	retry                 *RetryPolicy
+	restEncoding          RESTEncoding
+	compressMin           int64
+	unary                 []grpc.UnaryClientInterceptor
+	stream                []grpc.StreamClientInterceptor
+	statsHandlers         []stats.Handler
+	keepalive             *keepalive.ClientParameters
+	connPoolSize          int
+	proxy                 *url.URL
+	proxyErr              error
+	grpcCompressor        string
+	timeout               time.Duration
+	methodTimeouts        map[Method]time.Duration
+	streamIdleTimeout     time.Duration
+	endpoints             []APIEndpoint
+	maxFailures           int
+	ejectFor              time.Duration
+	preferLatency         bool
+	dialer                dialFunc
+	restSocket            string
+	observer              metrics.Observer
+	tracer                tracing.Tracer
+	redactHeaders         []string
+	redactFields          []string
+	noRedact              bool
 }
 
 // An Option is used to configure different parts of this package. Not every
@@ -44,7 +83,9 @@ func defaults(ts oauth2.TokenSource) *options {
 	o := options{
 		TokenSource: ts,
 		transport:   http.DefaultTransport,
-		debug:       ioutil.Discard,
+		log:         logger.Discard,
+		observer:    metrics.Discard,
+		tracer:      tracing.Noop,
 	}
 	WithRestBaseURL(DefaultRestBaseURL)(&o)
 	WithGrpcTarget(DefaultGrpcTarget)(&o)
@@ -71,9 +112,6 @@ func WithTransport(val http.RoundTripper) Option {
 
 	return func(o *options) {
 		o.transport = val
-		if o.tlsInsecureSkipVerify {
-			WithTLSInsecureSkipVerify()(o)
-		}
 	}
 }
 
@@ -83,15 +121,67 @@ func WithTransport(val http.RoundTripper) Option {
 func WithTLSInsecureSkipVerify() Option {
 	return func(o *options) {
 		o.tlsInsecureSkipVerify = true
-		if t, ok := o.transport.(*http.Transport); ok {
-			// #nosec
-			t.TLSClientConfig = &tls.Config{
-				InsecureSkipVerify: true,
-			}
-		}
 	}
 }
 
+// WithTLSConfig returns an Option that sets the base TLS configuration used
+// by both the RESTv1Client (if its transport is an *http.Transport) and the
+// GRPCv1Client. val is copied, later TLS Options modify the copy.
+func WithTLSConfig(val *tls.Config) Option {
+	return func(o *options) {
+		o.tlsConfig = val.Clone()
+	}
+}
+
+// WithRootCAs returns an Option that causes the server certificate to be
+// verified using val instead of the system roots, e.g. for a private CA or a
+// TLS inspecting proxy
+func WithRootCAs(val *x509.CertPool) Option {
+	return func(o *options) {
+		o.tls().RootCAs = val
+	}
+}
+
+// WithClientCertificate returns an Option that presents val to the server for
+// mutual TLS authentication. It may be given more than once.
+func WithClientCertificate(val tls.Certificate) Option {
+	return func(o *options) {
+		t := o.tls()
+		t.Certificates = append(t.Certificates, val)
+	}
+}
+
+// WithServerName returns an Option that overrides the host name used to
+// verify the server certificate
+func WithServerName(val string) Option {
+	return func(o *options) {
+		o.tls().ServerName = val
+	}
+}
+
+func (o *options) tls() *tls.Config {
+	if o.tlsConfig == nil {
+		o.tlsConfig = &tls.Config{}
+	}
+	return o.tlsConfig
+}
+
+// clientTLS returns the TLS configuration to use when connecting to zveloAPI
+func (o options) clientTLS() *tls.Config {
+	var t *tls.Config
+	if o.tlsConfig != nil {
+		t = o.tlsConfig.Clone()
+	} else {
+		t = &tls.Config{}
+	}
+
+	if o.tlsInsecureSkipVerify {
+		t.InsecureSkipVerify = true // #nosec
+	}
+
+	return t
+}
+
 // WithoutTLS disables TLS when connecting to zveloAPI
 func WithoutTLS() Option {
 	return func(o *options) {
@@ -101,15 +191,87 @@ func WithoutTLS() Option {
 }
 
 // WithDebug returns an Option that will cause requests from the RESTv1Client
-// and callbacks processed by the CallbackHandler to emit debug logs to the
-// writer
+// and calls from the GRPCv1Client to emit colorized, human readable debug logs
+// to the writer. It is equivalent to WithLogger(logger.Color(val)).
 func WithDebug(val io.Writer) Option {
+	return WithLogger(logger.Color(val))
+}
+
+// WithLogger returns an Option that will cause requests from the RESTv1Client
+// and calls from the GRPCv1Client to emit structured debug logs to val
+func WithLogger(val logger.Logger) Option {
 	if val == nil {
-		val = ioutil.Discard
+		val = logger.Discard
+	}
+
+	return func(o *options) {
+		o.log = val
+	}
+}
+
+// WithRedaction returns an Option that redacts the values of the headers (or
+// gRPC metadata keys) and the URL query, form and JSON fields from debug logs
+// in addition to logger.DefaultRedactHeaders and logger.DefaultRedactFields
+func WithRedaction(headers, fields []string) Option {
+	return func(o *options) {
+		o.redactHeaders = append(o.redactHeaders, headers...)
+		o.redactFields = append(o.redactFields, fields...)
+	}
+}
+
+// WithoutRedaction returns an Option that disables the redaction of secrets,
+// e.g. the Authorization header, from debug logs. Logs will contain
+// credentials.
+func WithoutRedaction() Option {
+	return func(o *options) {
+		o.noRedact = true
+	}
+}
+
+// redactLog applies the redaction configured by WithRedaction and
+// WithoutRedaction to the logger. It is called once all Options are applied.
+func (o *options) redactLog() {
+	if !o.noRedact {
+		o.log = logger.RedactDefaults(o.log, o.redactHeaders, o.redactFields)
+	}
+}
+
+// RESTEncoding is the wire format used for REST request and response bodies
+type RESTEncoding int
+
+// RESTEncodings supported by WithRESTEncoding
+const (
+	JSON RESTEncoding = iota
+	Protobuf
+)
+
+// WithRESTEncoding returns an Option that sets the wire format used by the
+// RESTv1Client for Query, Result and Suggest. With Protobuf, request bodies
+// are sent as application/x-protobuf and the server is asked to respond in
+// kind. JSON responses are still accepted. Stream and GraphQL always use
+// JSON. If not specified, JSON is used.
+func WithRESTEncoding(val RESTEncoding) Option {
+	return func(o *options) {
+		o.restEncoding = val
+	}
+}
+
+// DefaultCompressionThreshold is the minimum request body size that will be
+// compressed when WithRequestCompression is given a size <= 0
+const DefaultCompressionThreshold = 16 * 1024
+
+// WithRequestCompression returns an Option that causes RESTv1Client request
+// bodies of at least minSize bytes to be gzip compressed. Compressed responses
+// are always decompressed. The compressed size of responses is only logged
+// when the transport is an *http.Transport or one that doesn't decompress
+// responses itself.
+func WithRequestCompression(minSize int) Option {
+	if minSize <= 0 {
+		minSize = DefaultCompressionThreshold
 	}
 
 	return func(o *options) {
-		o.debug = val
+		o.compressMin = int64(minSize)
 	}
 }
 
@@ -121,32 +283,146 @@ func WithoutHTTP2() Option {
 }
 
 // WithRestBaseURL returns an Option that overrides the default base URL for all
-// zveloAPI requests
+// zveloAPI requests. A unix:///path/to/socket URL connects to a unix domain
+// socket, e.g. of a local sidecar.
 func WithRestBaseURL(val string) Option {
 	if val == "" {
 		val = DefaultRestBaseURL
 	}
 
 	return func(o *options) {
-		if !strings.Contains(val, "://") {
-			if o.restBaseURL != nil {
-				val = o.restBaseURL.Scheme + "://" + val
-			} else {
-				val = "https://" + val
-			}
+		scheme := "https"
+		if o.restBaseURL != nil {
+			scheme = o.restBaseURL.Scheme
 		}
 
-		if p, err := url.Parse(val); err == nil {
-			if p.Path == "" {
-				p.Path = "/"
+		if p, err := parseBaseURL(val, scheme); err == nil {
+			o.restSocket = ""
+			if p.Scheme == "unix" {
+				// the socket path replaces the host, calls use the root path
+				o.restSocket = p.Path
+				p = &url.URL{Scheme: "http", Host: "localhost", Path: "/"}
 			}
 			o.restBaseURL = p
 		}
 	}
 }
 
+// parseBaseURL parses val, using scheme if val doesn't have one
+func parseBaseURL(val, scheme string) (*url.URL, error) {
+	if !strings.Contains(val, "://") {
+		val = scheme + "://" + val
+	}
+
+	p, err := url.Parse(val)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.Path == "" {
+		p.Path = "/"
+	}
+
+	return p, nil
+}
+
+// WithUnaryInterceptor returns an Option that adds interceptors to unary calls
+// made by the GRPCv1Client. Interceptors are called in the order they are
+// added. The built-in retry interceptor (see WithRetry) is called before them,
+// so they see each attempt, and the built-in debug interceptor is called last,
+// immediately before the call is sent.
+func WithUnaryInterceptor(val ...grpc.UnaryClientInterceptor) Option {
+	return func(o *options) {
+		o.unary = append(o.unary, val...)
+	}
+}
+
+// WithStreamInterceptor returns an Option that adds interceptors to streaming
+// calls made by the GRPCv1Client. Interceptors are called in the order they
+// are added. The built-in debug interceptor is called last, immediately before
+// the call is sent.
+func WithStreamInterceptor(val ...grpc.StreamClientInterceptor) Option {
+	return func(o *options) {
+		o.stream = append(o.stream, val...)
+	}
+}
+
+// WithKeepalive returns an Option that causes the GRPCv1Client to send
+// keepalive pings according to val. This keeps idle connections from being
+// closed by load balancers and detects broken connections sooner.
+func WithKeepalive(val keepalive.ClientParameters) Option {
+	return func(o *options) {
+		o.keepalive = &val
+	}
+}
+
+// WithConnPoolSize returns an Option that causes the GRPCv1Dialer to open val
+// connections to zveloAPI. Each call is sent on the connection with the fewest
+// calls in flight. This avoids the HTTP/2 limit on concurrent streams of a
+// single connection.
+func WithConnPoolSize(val int) Option {
+	return func(o *options) {
+		o.connPoolSize = val
+	}
+}
+
+// WithProxy returns an Option that causes both the RESTv1Client and the
+// GRPCv1Client to connect to zveloAPI through the proxy at val. http and https
+// proxies are sent a CONNECT request, socks5 proxies are supported as well.
+// Credentials in the url are used for basic or socks5 authentication. If val
+// can't be parsed, Dial returns the error and every RESTv1Client request fails
+// with it. If not specified, both clients take the proxy from the HTTPS_PROXY
+// and NO_PROXY environment variables. Unix sockets are never proxied.
+func WithProxy(val string) Option {
+	return func(o *options) {
+		o.proxy, o.proxyErr = nil, nil
+
+		if val == "" {
+			return
+		}
+
+		p, err := url.Parse(val)
+		if err != nil {
+			o.proxyErr = errors.Wrap(err, "invalid proxy")
+			return
+		}
+
+		o.proxy = p
+	}
+}
+
+// WithGRPCCompressor returns an Option that causes the GRPCv1Client to
+// compress all messages it sends with the named compressor, e.g. "gzip". The
+// compressor must be registered with the grpc/encoding package. It can be
+// overridden for a single call with UseCompressor. Compressed messages that
+// are received are always decompressed transparently.
+func WithGRPCCompressor(val string) Option {
+	return func(o *options) {
+		o.grpcCompressor = val
+	}
+}
+
+// WithDialer returns an Option that causes both clients to use val to open
+// network connections, e.g. to connect through a tunnel. When a proxy is used,
+// val opens the connection to the proxy.
+func WithDialer(val func(ctx context.Context, network, addr string) (net.Conn, error)) Option {
+	return func(o *options) {
+		o.dialer = val
+	}
+}
+
+func (o options) dialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	if o.dialer != nil {
+		return o.dialer(ctx, network, addr)
+	}
+
+	var d net.Dialer
+	return d.DialContext(ctx, network, addr)
+}
+
 // WithGrpcTarget returns an Option that overrides the default gRPC target for
-// all zveloAPI requests
+// all zveloAPI requests. A unix:///path/to/socket target connects to a unix
+// domain socket, e.g. of a local sidecar.
 func WithGrpcTarget(val string) Option {
 	if val == "" {
 		val = DefaultGrpcTarget
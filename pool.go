@@ -0,0 +1,189 @@
+package zapi
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/golang/protobuf/ptypes/empty"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+
+	msg "zvelo.io/msg/msgpb"
+)
+
+// stateRank orders connectivity states from most to least useful. The state
+// of a pool is the most useful state of any of its connections.
+var stateRank = map[connectivity.State]int{
+	connectivity.Ready:            0,
+	connectivity.Connecting:       1,
+	connectivity.Idle:             2,
+	connectivity.TransientFailure: 3,
+	connectivity.Shutdown:         4,
+}
+
+type pooledConn struct {
+	GRPCv1Client
+	inflight int64
+}
+
+// grpcV1Pool is a GRPCv1Client that spreads calls across several connections
+type grpcV1Pool struct {
+	conns []*pooledConn
+	next  uint32
+}
+
+func newGRPCv1Pool(conns []GRPCv1Client) *grpcV1Pool {
+	p := grpcV1Pool{conns: make([]*pooledConn, len(conns))}
+	for i, c := range conns {
+		p.conns[i] = &pooledConn{GRPCv1Client: c}
+	}
+	return &p
+}
+
+// pick returns the connection in the most useful state, e.g. a READY
+// connection is preferred over an IDLE or CONNECTING one, and those over a
+// connection that failed. Of those, the one with the fewest calls in flight is
+// returned. Ties are broken round robin.
+func (p *grpcV1Pool) pick() *pooledConn {
+	start := int(atomic.AddUint32(&p.next, 1))
+
+	var best *pooledConn
+	bestRank, bestN := 0, int64(-1)
+
+	for i := range p.conns {
+		c := p.conns[(start+i)%len(p.conns)]
+		rank := stateRank[c.State()]
+		n := atomic.LoadInt64(&c.inflight)
+		if best == nil || rank < bestRank || (rank == bestRank && n < bestN) {
+			best, bestRank, bestN = c, rank, n
+		}
+	}
+
+	return best
+}
+
+func (p *grpcV1Pool) call(fn func(GRPCv1Client) error) error {
+	c := p.pick()
+	atomic.AddInt64(&c.inflight, 1)
+	defer atomic.AddInt64(&c.inflight, -1)
+	return fn(c.GRPCv1Client)
+}
+
+func (p *grpcV1Pool) Query(ctx context.Context, in *msg.QueryRequests, opts ...grpc.CallOption) (resp *msg.QueryReplies, err error) {
+	err = p.call(func(c GRPCv1Client) error {
+		resp, err = c.Query(ctx, in, opts...)
+		return err
+	})
+	return
+}
+
+func (p *grpcV1Pool) Result(ctx context.Context, in *msg.RequestID, opts ...grpc.CallOption) (resp *msg.QueryResult, err error) {
+	err = p.call(func(c GRPCv1Client) error {
+		resp, err = c.Result(ctx, in, opts...)
+		return err
+	})
+	return
+}
+
+func (p *grpcV1Pool) Suggest(ctx context.Context, in *msg.Suggestion, opts ...grpc.CallOption) (resp *empty.Empty, err error) {
+	err = p.call(func(c GRPCv1Client) error {
+		resp, err = c.Suggest(ctx, in, opts...)
+		return err
+	})
+	return
+}
+
+func (p *grpcV1Pool) Stream(ctx context.Context, in *empty.Empty, opts ...grpc.CallOption) (msg.APIv1_StreamClient, error) {
+	return p.pick().Stream(ctx, in, opts...)
+}
+
+// Close closes every connection in the pool and returns the first error
+func (p *grpcV1Pool) Close() error {
+	var err error
+	for _, c := range p.conns {
+		if cerr := c.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// State returns the most useful state of any connection in the pool, e.g. it
+// is READY if any connection is READY
+func (p *grpcV1Pool) State() connectivity.State {
+	state := connectivity.Shutdown
+	for _, c := range p.conns {
+		if s := c.State(); stateRank[s] < stateRank[state] {
+			state = s
+		}
+	}
+	return state
+}
+
+// WaitForReady blocks until any connection in the pool is READY
+func (p *grpcV1Pool) WaitForReady(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errs := make(chan error, len(p.conns))
+	for _, c := range p.conns {
+		go func(c GRPCv1Client) {
+			errs <- c.WaitForReady(ctx)
+		}(c.GRPCv1Client)
+	}
+
+	var err error
+	for range p.conns {
+		if err = <-errs; err == nil {
+			return nil
+		}
+	}
+
+	return err
+}
+
+func (p *grpcV1Pool) WatchState(ctx context.Context) <-chan connectivity.State {
+	ch := make(chan connectivity.State)
+	changed := make(chan struct{})
+
+	var wg sync.WaitGroup
+	for _, c := range p.conns {
+		wg.Add(1)
+		go func(watch <-chan connectivity.State) {
+			defer wg.Done()
+			for range watch {
+				select {
+				case changed <- struct{}{}:
+				case <-ctx.Done():
+				}
+			}
+		}(c.WatchState(ctx))
+	}
+
+	go func() {
+		wg.Wait()
+		close(changed)
+	}()
+
+	go func() {
+		defer close(ch)
+
+		last := connectivity.State(-1)
+		for range changed {
+			state := p.State()
+			if state == last {
+				continue
+			}
+			last = state
+
+			select {
+			case ch <- state:
+			case <-ctx.Done():
+			}
+		}
+	}()
+
+	return ch
+}
@@ -0,0 +1,109 @@
+package zapi
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+
+	msg "zvelo.io/msg/msgpb"
+)
+
+type poolTestConn struct {
+	GRPCv1Client
+	state   connectivity.State
+	started chan struct{}
+	release chan struct{}
+	calls   int
+	closed  bool
+}
+
+func (c *poolTestConn) Result(ctx context.Context, in *msg.RequestID, opts ...grpc.CallOption) (*msg.QueryResult, error) {
+	c.calls++
+	c.started <- struct{}{}
+	<-c.release
+	return &msg.QueryResult{RequestId: in.RequestId}, nil
+}
+
+func (c *poolTestConn) State() connectivity.State {
+	return c.state
+}
+
+func (c *poolTestConn) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestPool(t *testing.T) {
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+
+	conns := []*poolTestConn{
+		{state: connectivity.TransientFailure, started: started, release: release},
+		{state: connectivity.Ready, started: started, release: release},
+		{state: connectivity.Ready, started: started, release: release},
+		{state: connectivity.Connecting, started: started, release: release},
+	}
+
+	var clients []GRPCv1Client
+	for _, c := range conns {
+		clients = append(clients, c)
+	}
+
+	pool := newGRPCv1Pool(clients)
+
+	if s := pool.State(); s != connectivity.Ready {
+		t.Errorf("expected READY, got %s", s)
+	}
+
+	// calls are spread across the READY conns only
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := pool.Result(context.Background(), &msg.RequestID{RequestId: "abc"}); err != nil {
+				t.Error(err)
+			}
+		}()
+
+		// wait for the call to be in flight before making the next one
+		<-started
+	}
+
+	close(release)
+	wg.Wait()
+
+	for i, calls := range []int{0, 2, 2, 0} {
+		if conns[i].calls != calls {
+			t.Errorf("expected conn %d to have %d calls, got %d", i, calls, conns[i].calls)
+		}
+	}
+
+	// without a READY conn, one that is connecting is preferred over a broken
+	// one
+
+	conns[1].state = connectivity.TransientFailure
+	conns[2].state = connectivity.Shutdown
+
+	if _, err := pool.Result(context.Background(), &msg.RequestID{RequestId: "abc"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if conns[3].calls != 1 {
+		t.Errorf("expected the connecting conn to have 1 call, got %d", conns[3].calls)
+	}
+
+	if err := pool.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, c := range conns {
+		if !c.closed {
+			t.Errorf("expected conn %d to be closed", i)
+		}
+	}
+}
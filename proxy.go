@@ -0,0 +1,179 @@
+package zapi
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/proxy"
+)
+
+type dialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// proxyError returns an http.Transport Proxy func that fails every request
+// with err
+func proxyError(err error) func(*http.Request) (*url.URL, error) {
+	return func(*http.Request) (*url.URL, error) {
+		return nil, err
+	}
+}
+
+// proxyDialer returns a function that connects to addr through the proxy at u
+// using forward to connect to the proxy itself. http and https proxies are
+// sent a CONNECT request, socks5 proxies are supported as well. The TLS
+// connection to https proxies uses the roots and other settings of tlsConfig.
+func proxyDialer(u *url.URL, forward dialFunc, tlsConfig *tls.Config) (func(ctx context.Context, addr string) (net.Conn, error), error) {
+	switch u.Scheme {
+	case "http", "https":
+		return func(ctx context.Context, addr string) (net.Conn, error) {
+			return connectProxy(ctx, u, forward, tlsConfig, addr)
+		}, nil
+	case "socks5", "socks5h":
+		var auth *proxy.Auth
+		if u.User != nil {
+			auth = &proxy.Auth{User: u.User.Username()}
+			auth.Password, _ = u.User.Password()
+		}
+
+		d, err := proxy.SOCKS5("tcp", u.Host, auth, forwardDialer(forward))
+		if err != nil {
+			return nil, err
+		}
+
+		cd, ok := d.(interface {
+			DialContext(ctx context.Context, network, addr string) (net.Conn, error)
+		})
+		if !ok {
+			return nil, errors.New("socks5 dialer does not support contexts")
+		}
+
+		return func(ctx context.Context, addr string) (net.Conn, error) {
+			return cd.DialContext(ctx, "tcp", addr)
+		}, nil
+	}
+
+	return nil, errors.Errorf("unsupported proxy scheme: %s", u.Scheme)
+}
+
+// grpcAuthority returns the host:port of a gRPC target, e.g. of
+// "dns:///api.zvelo.com:443"
+func grpcAuthority(target string) string {
+	if i := strings.LastIndex(target, "/"); i >= 0 {
+		return target[i+1:]
+	}
+	return target
+}
+
+// envProxy returns the proxy from the HTTPS_PROXY and NO_PROXY environment
+// variables to use for authority, or nil if there is none
+func envProxy(authority string) (*url.URL, error) {
+	return http.ProxyFromEnvironment(&http.Request{
+		URL: &url.URL{Scheme: "https", Host: authority},
+	})
+}
+
+// forwardDialer adapts a dialFunc to a proxy.Dialer
+type forwardDialer dialFunc
+
+func (d forwardDialer) Dial(network, addr string) (net.Conn, error) {
+	return d(context.Background(), network, addr)
+}
+
+func (d forwardDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	return d(ctx, network, addr)
+}
+
+// connectProxy opens a tunnel to addr through the http proxy at u
+func connectProxy(ctx context.Context, u *url.URL, forward dialFunc, tlsConfig *tls.Config, addr string) (net.Conn, error) {
+	host := u.Host
+	if u.Port() == "" {
+		if u.Scheme == "https" {
+			host = net.JoinHostPort(u.Hostname(), "443")
+		} else {
+			host = net.JoinHostPort(u.Hostname(), "80")
+		}
+	}
+
+	conn, err := forward(ctx, "tcp", host)
+	if err != nil {
+		return nil, err
+	}
+
+	// the deadline also bounds the TLS handshake with an https proxy
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)      // #nosec
+		defer conn.SetDeadline(time.Time{}) // #nosec
+	}
+
+	if u.Scheme == "https" {
+		cfg := &tls.Config{}
+		if tlsConfig != nil {
+			cfg = tlsConfig.Clone()
+		}
+		cfg.ServerName = u.Hostname()
+		cfg.NextProtos = nil
+
+		tc := tls.Client(conn, cfg)
+		if err = tc.Handshake(); err != nil {
+			_ = conn.Close() // #nosec
+			return nil, err
+		}
+		conn = tc
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: http.Header{},
+	}
+
+	if u.User != nil {
+		password, _ := u.User.Password()
+		auth := u.User.Username() + ":" + password
+		req.Header.Set("Proxy-Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(auth)))
+	}
+
+	if err = req.Write(conn); err != nil {
+		_ = conn.Close() // #nosec
+		return nil, err
+	}
+
+	r := bufio.NewReader(conn)
+
+	res, err := http.ReadResponse(r, req)
+	if err != nil {
+		_ = conn.Close() // #nosec
+		return nil, err
+	}
+	_ = res.Body.Close() // #nosec
+
+	if res.StatusCode != http.StatusOK {
+		_ = conn.Close() // #nosec
+		return nil, errors.Errorf("proxy CONNECT to %s failed: %s", addr, res.Status)
+	}
+
+	if r.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, r: r}, nil
+	}
+
+	return conn, nil
+}
+
+// bufferedConn is a net.Conn that first returns data that was read ahead
+// while reading the proxy response
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
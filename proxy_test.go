@@ -0,0 +1,206 @@
+package zapi
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	msg "zvelo.io/msg/msgpb"
+)
+
+// serveConnectProxy accepts a single CONNECT request and tunnels it
+func serveConnectProxy(t *testing.T, lis net.Listener, auth chan<- string) {
+	conn, err := lis.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close() // #nosec
+
+	r := bufio.NewReader(conn)
+
+	req, err := http.ReadRequest(r)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	auth <- req.Header.Get("Proxy-Authorization")
+
+	if req.Method != http.MethodConnect {
+		t.Errorf("unexpected method: %s", req.Method)
+		return
+	}
+
+	upstream, err := net.Dial("tcp", req.Host)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer upstream.Close() // #nosec
+
+	if _, err = io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n"); err != nil {
+		t.Error(err)
+		return
+	}
+
+	go func() { _, _ = io.Copy(upstream, r) }()
+	_, _ = io.Copy(conn, upstream)
+}
+
+func TestProxy(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := grpc.NewServer()
+	go func() { _ = srv.Serve(lis) }()
+	defer srv.Stop()
+
+	proxyLis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer proxyLis.Close() // #nosec
+
+	auth := make(chan string, 1)
+	go serveConnectProxy(t, proxyLis, auth)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client, err := NewGRPCv1(nil,
+		WithoutTLS(),
+		WithGrpcTarget(lis.Addr().String()),
+		WithProxy("http://user:pass@"+proxyLis.Addr().String()),
+	).Dial(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close() // #nosec
+
+	// the server doesn't implement the api, so reaching it is enough
+	_, err = client.Result(ctx, &msg.RequestID{RequestId: "abc"})
+	if status.Code(err) != codes.Unimplemented {
+		t.Errorf("expected Unimplemented, got: %v", err)
+	}
+
+	if a := <-auth; a != "Basic "+base64.StdEncoding.EncodeToString([]byte("user:pass")) {
+		t.Errorf("unexpected Proxy-Authorization: %q", a)
+	}
+
+	if _, err = proxyDialer(&url.URL{Scheme: "ftp", Host: "example.com"}, nil, nil); err == nil {
+		t.Error("expected error for unsupported proxy scheme")
+	}
+}
+
+func TestConnectProxyHandshakeDeadline(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close() // #nosec
+
+	// accept the connection but never complete the TLS handshake
+	go func() {
+		conn, err := lis.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close() // #nosec
+		_, _ = io.Copy(ioutil.Discard, conn)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	u := url.URL{Scheme: "https", Host: lis.Addr().String()}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := connectProxy(ctx, &u, (&net.Dialer{}).DialContext, nil, "example.com:443")
+		done <- err
+	}()
+
+	select {
+	case err = <-done:
+		if err == nil {
+			t.Error("expected error")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("TLS handshake with the proxy ignored the deadline")
+	}
+}
+
+func TestInvalidProxy(t *testing.T) {
+	var calls int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+	}))
+	defer srv.Close()
+
+	const proxy = "http://[::1"
+
+	if _, err := NewGRPCv1(nil, WithoutTLS(), WithProxy(proxy)).Dial(context.Background()); err == nil {
+		t.Error("expected Dial to fail with an invalid proxy")
+	}
+
+	client := NewRESTv1(nil, WithRestBaseURL(srv.URL), WithProxy(proxy))
+	if _, err := client.Result(context.Background(), "abc"); err == nil {
+		t.Error("expected request to fail with an invalid proxy")
+	}
+
+	if calls != 0 {
+		t.Errorf("expected no direct connection, got %d calls", calls)
+	}
+}
+
+func TestConnectProxyTLS(t *testing.T) {
+	hosts := make(chan string, 1)
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hosts <- r.Host
+	}))
+	defer srv.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+
+	d, ok := NewGRPCv1(nil,
+		WithProxy(srv.URL),
+		WithTLSConfig(&tls.Config{RootCAs: roots}),
+	).(grpcV1Dialer)
+	if !ok {
+		t.Fatal("unexpected dialer type")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// the proxy is sent the authority, not the resolved address
+	conn, err := d.contextDialer("api.example.com:443")(ctx, "192.0.2.1:443")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.Close() // #nosec
+
+	if h := <-hosts; h != "api.example.com:443" {
+		t.Errorf("unexpected CONNECT host: %s", h)
+	}
+}
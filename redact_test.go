@@ -0,0 +1,55 @@
+package zapi
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+func TestRedaction(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentTypeJSON)
+		w.Header().Set("X-Session", "s3ss10n")
+		_, _ = w.Write([]byte(`{"requestId":"abc"}`)) // #nosec
+	}))
+	defer srv.Close()
+
+	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "t0k3n"})
+
+	var debug bytes.Buffer
+	client := NewRESTv1(ts,
+		WithRestBaseURL(srv.URL),
+		WithDebug(&debug),
+		WithRedaction([]string{"X-Session"}, nil),
+	)
+
+	if _, err := client.Result(context.Background(), "abc"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, s := range []string{"t0k3n", "s3ss10n"} {
+		if strings.Contains(debug.String(), s) {
+			t.Errorf("%q not redacted:\n%s", s, debug.String())
+		}
+	}
+
+	if !strings.Contains(debug.String(), "Authorization: Bearer REDACTED") {
+		t.Errorf("expected redacted Authorization header:\n%s", debug.String())
+	}
+
+	debug.Reset()
+	client = NewRESTv1(ts, WithRestBaseURL(srv.URL), WithDebug(&debug), WithoutRedaction())
+
+	if _, err := client.Result(context.Background(), "abc"); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(debug.String(), "Authorization: Bearer t0k3n") {
+		t.Errorf("expected Authorization header:\n%s", debug.String())
+	}
+}
@@ -7,13 +7,13 @@ import (
 	"encoding/json"
 	"io"
 	"io/ioutil"
+	"mime"
+	"net"
 	"net/http"
-	"strconv"
-	"strings"
+	"time"
 
 	"github.com/gogo/protobuf/jsonpb"
 	"github.com/gogo/protobuf/proto"
-	"github.com/pkg/errors"
 
 	"golang.org/x/net/http2"
 	"golang.org/x/oauth2"
@@ -22,6 +22,8 @@ import (
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 
+	"zvelo.io/go-zapi/logger"
+	"zvelo.io/go-zapi/tracing"
 	msg "zvelo.io/msg/msgpb"
 )
 
@@ -32,6 +34,11 @@ const (
 	graphQLPath   = "/graphql"
 )
 
+const (
+	contentTypeJSON     = "application/json"
+	contentTypeProtobuf = "application/x-protobuf"
+)
+
 var (
 	jsonMarshaler   jsonpb.Marshaler
 	jsonUnmarshaler = jsonpb.Unmarshaler{
@@ -96,14 +103,66 @@ type RESTv1Client interface {
 	Stream(ctx context.Context) (RESTv1StreamClient, error)
 }
 
+// newTransport returns an *http.Transport configured like
+// http.DefaultTransport
+func newTransport() *http.Transport {
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+}
+
 // NewRESTv1 returns a properly configured RESTv1Client
 func NewRESTv1(ts oauth2.TokenSource, opts ...Option) RESTv1Client {
 	o := defaults(ts)
 	for _, opt := range opts {
 		opt(o)
 	}
+	o.redactLog()
+
+	customTLS := o.tlsConfig != nil || o.tlsInsecureSkipVerify
+	customDial := o.dialer != nil || o.restSocket != ""
+
+	customProxy := o.proxy != nil || o.proxyErr != nil
+
+	if o.proxyErr != nil {
+		o.log.Log(logger.Error, "invalid proxy, requests will fail", "error", o.proxyErr)
+	}
+
+	if o.transport == http.DefaultTransport && (customTLS || customDial || customProxy) {
+		// don't modify the transport shared by the rest of the process
+		o.transport = newTransport()
+	}
 
 	if t, ok := o.transport.(*http.Transport); ok {
+		if customTLS {
+			t.TLSClientConfig = o.clientTLS()
+		}
+
+		if o.proxyErr != nil {
+			// never fall back to connecting directly
+			t.Proxy = proxyError(o.proxyErr)
+		} else if o.proxy != nil {
+			t.Proxy = http.ProxyURL(o.proxy)
+		}
+
+		if o.restSocket != "" {
+			socket := o.restSocket
+			t.Proxy = nil
+			t.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return o.dialContext(ctx, "unix", socket)
+			}
+		} else if o.dialer != nil {
+			t.DialContext = o.dialer
+		}
+
 		if o.noHTTP2 {
 			t.TLSNextProto = map[string]func(authority string, c *tls.Conn) http.RoundTripper{}
 		} else {
@@ -115,54 +174,99 @@ func NewRESTv1(ts oauth2.TokenSource, opts ...Option) RESTv1Client {
 
 	return &restV1Client{
 		options: o,
-		client:  &http.Client{Transport: &transport{options: o}},
+		client: &http.Client{Transport: &transport{
+			options:   o,
+			endpoints: newRESTEndpoints(o),
+		}},
 	}
 }
 
-func (c *restV1Client) GraphQL(ctx context.Context, query string, result interface{}, opts ...CallOption) error {
-	url := c.options.restURL(graphQLPath)
+// GraphQL sends query and decodes the entire response body, including any
+// errors, into result. If the response contains errors, they are also returned
+// as GraphQLErrors. Use GraphQLExecutor for variables.
+func (c *restV1Client) GraphQL(ctx context.Context, query string, result interface{}, opts ...CallOption) (err error) {
+	ctx, cancel := c.options.withTimeout(ctx, MethodGraphQL)
+	defer cancel()
+	ctx = withMethod(ctx, MethodGraphQL)
 
-	query = `{"query":` + strconv.QuoteToASCII(query) + `}`
+	ctx, span := c.options.startSpan(ctx, MethodGraphQL)
+	defer func() { span.End(err) }()
 
-	body, err := c.do(ctx, "POST", url, strings.NewReader(query), opts...)
+	body, err := c.graphQL(ctx, &GraphQLRequest{Query: query}, opts...)
 	if err != nil {
 		return err
 	}
 	defer func() { _ = body.Close() }() // #nosec
 
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return err
+	}
+
 	if ps, ok := result.(*string); ok {
-		s, err := ioutil.ReadAll(body)
-		if err != nil {
-			return err
-		}
-		*ps = string(s)
-		return nil
+		*ps = string(data)
+	} else if err = json.Unmarshal(data, result); err != nil {
+		return err
 	}
 
-	return json.NewDecoder(body).Decode(result)
+	var resp graphQLResponse
+	if json.Unmarshal(data, &resp) == nil && len(resp.Errors) > 0 {
+		return resp.Errors
+	}
+
+	return nil
 }
 
 func (c *restV1Client) Query(ctx context.Context, in *msg.QueryRequests, opts ...CallOption) (*msg.QueryReplies, error) {
+	ctx, cancel := c.options.withTimeout(ctx, MethodQuery)
+	defer cancel()
+	ctx = withMethod(ctx, MethodQuery)
+
+	ctx, span := c.options.startSpan(ctx, MethodQuery)
+
 	url := c.options.restURL(queryV1Path)
+	if c.options.retry.retryQuery() {
+		ctx = context.WithValue(ctx, retryQueryKey, true)
+	}
 	var replies msg.QueryReplies
 	if err := c.doPB(ctx, "POST", url, in, &replies, opts...); err != nil {
+		span.End(err)
 		return nil, err
 	}
+	span.SetAttribute(tracing.AttrRequestIDs, requestIDs(&replies))
+	span.End(nil)
 	return &replies, nil
 }
 
 func (c *restV1Client) Result(ctx context.Context, reqID string, opts ...CallOption) (*msg.QueryResult, error) {
+	ctx, cancel := c.options.withTimeout(ctx, MethodResult)
+	defer cancel()
+	ctx = withMethod(ctx, MethodResult)
+
+	ctx, span := c.options.startSpan(ctx, MethodResult)
+	span.SetAttribute(tracing.AttrRequestID, reqID)
+
 	url := c.options.restURL(queryV1Path, reqID)
 	var result msg.QueryResult
 	if err := c.doPB(ctx, "GET", url, nil, &result, opts...); err != nil {
+		span.End(err)
 		return nil, err
 	}
+	span.End(nil)
 	return &result, nil
 }
 
 func (c *restV1Client) Suggest(ctx context.Context, in *msg.Suggestion, opts ...CallOption) error {
+	ctx, cancel := c.options.withTimeout(ctx, MethodSuggest)
+	defer cancel()
+	ctx = withMethod(ctx, MethodSuggest)
+
+	ctx, span := c.options.startSpan(ctx, MethodSuggest)
+
 	url := c.options.restURL(suggestV1Path)
-	return c.doPB(ctx, "POST", url, in, nil, opts...)
+	err := c.doPB(ctx, "POST", url, in, nil, opts...)
+	span.End(err)
+	return err
 }
 
 type errorBody struct {
@@ -170,10 +274,73 @@ type errorBody struct {
 	Code  codes.Code `json:"code"`
 }
 
+// maxErrorBody is the maximum number of bytes of an error response body that
+// are read
+const maxErrorBody = 64 << 10
+
+// An HTTPError is returned by the RESTv1Client when the server responds with
+// a status other than 200 OK and a body that isn't a gRPC status
+type HTTPError struct {
+	StatusCode int
+	Status     string
+
+	// Body is the start of the response body
+	Body []byte
+}
+
+func (e *HTTPError) Error() string {
+	return "http error: " + e.Status
+}
+
 func (c *restV1Client) do(ctx context.Context, method, url string, body io.Reader, opts ...CallOption) (io.ReadCloser, error) {
+	idempotent := method == http.MethodGet
+	if val, ok := ctx.Value(retryQueryKey).(bool); ok && val {
+		idempotent = true
+	}
+
+	attempts := c.options.retry.attempts(idempotent)
+
+	var bodyData []byte
+	if body != nil && attempts > 1 {
+		// buffer the body so that it can be resent
+		var err error
+		if bodyData, err = ioutil.ReadAll(body); err != nil {
+			return nil, err
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		if bodyData != nil {
+			body = bytes.NewReader(bodyData)
+		}
+
+		rc, resp, err := c.doOnce(ctx, method, url, body, opts...)
+		if err == nil || attempt+1 >= attempts || ctx.Err() != nil {
+			return rc, err
+		}
+
+		var retryAfter string
+		if resp != nil {
+			if !c.options.retry.retryHTTP(resp.StatusCode) && !c.options.retry.retryCode(status.Code(err)) {
+				return nil, err
+			}
+			retryAfter = resp.Header.Get("Retry-After")
+		} else if !retryableNetErr(err) {
+			return nil, err
+		}
+
+		if serr := sleep(ctx, c.options.retry.delay(attempt, retryAfter)); serr != nil {
+			return nil, err
+		}
+	}
+}
+
+// doOnce makes a single request. If a response was received, it is returned
+// even if err is not nil, but its body will have been closed.
+func (c *restV1Client) doOnce(ctx context.Context, method, url string, body io.Reader, opts ...CallOption) (io.ReadCloser, *http.Response, error) {
 	req, err := http.NewRequest(method, url, body)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	if md, ok := metadata.FromOutgoingContext(ctx); ok {
@@ -184,7 +351,7 @@ func (c *restV1Client) do(ctx context.Context, method, url string, body io.Reade
 		}
 	}
 
-	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Type", contentTypeJSON)
 
 	for _, opt := range opts {
 		opt.before(req)
@@ -192,7 +359,7 @@ func (c *restV1Client) do(ctx context.Context, method, url string, body io.Reade
 
 	resp, err := c.client.Do(req.WithContext(ctx))
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	for _, opt := range opts {
@@ -200,29 +367,60 @@ func (c *restV1Client) do(ctx context.Context, method, url string, body io.Reade
 	}
 
 	if resp.StatusCode != http.StatusOK {
+		data, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorBody)) // #nosec
+		_ = resp.Body.Close()                                              // #nosec
+
 		// try to resolve the body as a grpc error
 		var eb errorBody
-		if err = json.NewDecoder(resp.Body).Decode(&eb); err == nil && eb.Error != "" && eb.Code != 0 {
-			_ = resp.Body.Close() // #nosec
-			return nil, status.Error(eb.Code, eb.Error)
+		if err = json.Unmarshal(data, &eb); err == nil && eb.Error != "" && eb.Code != 0 {
+			return nil, resp, status.Error(eb.Code, eb.Error)
+		}
+
+		return nil, resp, &HTTPError{
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+			Body:       data,
 		}
-		_ = resp.Body.Close() // #nosec
-		return nil, errors.Errorf("http error: %s", resp.Status)
 	}
 
-	return resp.Body, nil
+	return resp.Body, resp, nil
+}
+
+func setHeader(key, val string) CallOption {
+	return beforeCall(func(r *http.Request) {
+		r.Header.Set(key, val)
+	})
 }
 
 func (c *restV1Client) doPB(ctx context.Context, method, url string, in, out proto.Message, opts ...CallOption) error {
+	var pre []CallOption
+
 	var reqBody io.Reader
 	if in != nil {
 		var buf bytes.Buffer
-		if err := jsonMarshaler.Marshal(&buf, in); err != nil {
+		if c.options.restEncoding == Protobuf {
+			data, err := proto.Marshal(in)
+			if err != nil {
+				return err
+			}
+			buf.Write(data)
+			pre = append(pre, setHeader("Content-Type", contentTypeProtobuf))
+		} else if err := jsonMarshaler.Marshal(&buf, in); err != nil {
 			return err
 		}
 		reqBody = &buf
 	}
 
+	if c.options.restEncoding == Protobuf {
+		pre = append(pre, setHeader("Accept", contentTypeProtobuf+", "+contentTypeJSON+";q=0.5"))
+	}
+
+	var respType string
+	opts = append(pre, opts...)
+	opts = append(opts, afterCall(func(resp *http.Response) {
+		respType = resp.Header.Get("Content-Type")
+	}))
+
 	body, err := c.do(ctx, method, url, reqBody, opts...)
 	if err != nil {
 		return err
@@ -233,27 +431,50 @@ func (c *restV1Client) doPB(ctx context.Context, method, url string, in, out pro
 		return nil
 	}
 
+	if mt, _, _ := mime.ParseMediaType(respType); mt == contentTypeProtobuf {
+		data, err := ioutil.ReadAll(body)
+		if err != nil {
+			return err
+		}
+		return proto.Unmarshal(data, out)
+	}
+
+	// fall back to json if the server doesn't support protobuf
 	return jsonUnmarshaler.Unmarshal(body, out)
 }
 
 type restV1StreamClient struct {
 	io.Closer
 	*json.Decoder
+	idle *idleTimer
 }
 
 func (c *restV1Client) Stream(ctx context.Context) (RESTv1StreamClient, error) {
 	url := c.options.restURL(streamV1Path)
 
 	ctx = context.WithValue(ctx, debugDumpResponseBodyKey, false)
+	ctx = withMethod(ctx, MethodStream)
+
+	var idle *idleTimer
+	if c.options.streamIdleTimeout > 0 {
+		ctx, idle = newIdleTimer(ctx, c.options.streamIdleTimeout)
+	}
+
+	ctx, span := c.options.startSpan(ctx, MethodStream)
 
 	body, err := c.do(ctx, "GET", url, nil)
 	if err != nil {
+		err = idle.done(err)
+		span.End(err)
 		return nil, err
 	}
 
+	span.End(nil)
+
 	return restV1StreamClient{
 		Closer:  body,
 		Decoder: json.NewDecoder(body),
+		idle:    idle,
 	}, nil
 }
 
@@ -287,9 +508,11 @@ func (c restV1StreamClient) Recv() (*msg.QueryResult, error) {
 			_ = c.Close() // #nosec
 		}
 
-		return nil, err
+		return nil, c.idle.done(err)
 	}
 
+	c.idle.reset()
+
 	if err := item.Err(); err != nil {
 		return nil, err
 	}
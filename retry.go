@@ -0,0 +1,209 @@
+package zapi
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+)
+
+// A RetryPolicy describes which failed zveloAPI calls should be retried and
+// how. Only idempotent calls (e.g. Result) are retried unless RetryQuery is
+// set.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first
+	MaxAttempts int
+
+	// Backoff determines the delay between attempts. A Retry-After header (or
+	// retry-after trailer for gRPC) sent by the server takes precedence, but
+	// is capped at Backoff.Max.
+	Backoff Backoff
+
+	// HTTPStatusCodes are the http status codes that will be retried by the
+	// RESTv1Client
+	HTTPStatusCodes []int
+
+	// Codes are the gRPC status codes that will be retried by the
+	// GRPCv1Client. They also apply to errors decoded from REST responses.
+	Codes []codes.Code
+
+	// RetryQuery enables retries for Query calls. Since Query is not
+	// idempotent, retrying may cause the same URL to be queried more than
+	// once.
+	RetryQuery bool
+}
+
+// DefaultRetryPolicy is used for any fields not set in the RetryPolicy passed
+// to WithRetry
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	Backoff:     DefaultBackoff,
+	HTTPStatusCodes: []int{
+		http.StatusTooManyRequests,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout,
+	},
+	Codes: []codes.Code{
+		codes.Unavailable,
+		codes.ResourceExhausted,
+	},
+}
+
+// WithRetry returns an Option that causes the RESTv1Client and GRPCv1Client
+// to retry calls that fail with one of the retryable codes in val. Zero valued
+// fields of val are replaced with those from DefaultRetryPolicy.
+func WithRetry(val RetryPolicy) Option {
+	if val.MaxAttempts <= 0 {
+		val.MaxAttempts = DefaultRetryPolicy.MaxAttempts
+	}
+
+	if val.Backoff == (Backoff{}) {
+		val.Backoff = DefaultRetryPolicy.Backoff
+	}
+
+	if len(val.HTTPStatusCodes) == 0 {
+		val.HTTPStatusCodes = DefaultRetryPolicy.HTTPStatusCodes
+	}
+
+	if len(val.Codes) == 0 {
+		val.Codes = DefaultRetryPolicy.Codes
+	}
+
+	return func(o *options) {
+		o.retry = &val
+	}
+}
+
+// attempts returns the maximum number of attempts for a call. Calls that are
+// not idempotent are only attempted once.
+func (p *RetryPolicy) attempts(idempotent bool) int {
+	if p == nil || !idempotent {
+		return 1
+	}
+
+	return p.MaxAttempts
+}
+
+func (p *RetryPolicy) retryQuery() bool {
+	return p != nil && p.RetryQuery
+}
+
+func (p *RetryPolicy) retryHTTP(statusCode int) bool {
+	for _, c := range p.HTTPStatusCodes {
+		if c == statusCode {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *RetryPolicy) retryCode(code codes.Code) bool {
+	for _, c := range p.Codes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// delay returns how long to wait before the next attempt. retryAfter, if
+// non-empty, is the value of a Retry-After header.
+func (p *RetryPolicy) delay(attempt int, retryAfter string) time.Duration {
+	if d, ok := parseRetryAfter(retryAfter); ok {
+		if p.Backoff.Max > 0 && d > p.Backoff.Max {
+			d = p.Backoff.Max
+		}
+		return d
+	}
+
+	return p.Backoff.Delay(attempt)
+}
+
+func parseRetryAfter(val string) (time.Duration, bool) {
+	val = strings.TrimSpace(val)
+	if val == "" {
+		return 0, false
+	}
+
+	if secs, err := strconv.Atoi(val); err == nil {
+		if secs < 0 {
+			return 0, false
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+
+	if t, err := http.ParseTime(val); err == nil {
+		d := time.Until(t)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+
+	return 0, false
+}
+
+func retryAfterMD(md metadata.MD) string {
+	if vs := md.Get("retry-after"); len(vs) > 0 {
+		return vs[0]
+	}
+	return ""
+}
+
+// retryableNetErr returns whether err, returned by a REST request that didn't
+// receive a response, is a transient network failure. Permanent failures such
+// as invalid URLs, certificate errors and refused connections are not
+// retried.
+func retryableNetErr(err error) bool {
+	if uerr, ok := err.(*url.Error); ok {
+		err = uerr.Err
+	}
+
+	err = errors.Cause(err)
+
+	if err == io.ErrUnexpectedEOF || err == io.EOF {
+		return true
+	}
+
+	if oerr, ok := err.(*net.OpError); ok {
+		cause := oerr.Err
+		if serr, ok := cause.(*os.SyscallError); ok {
+			cause = serr.Err
+		}
+
+		// the connection was closed by the server or a proxy, e.g. when it
+		// restarted
+		switch cause {
+		case syscall.ECONNRESET, syscall.ECONNABORTED, syscall.EPIPE:
+			return true
+		}
+	}
+
+	nerr, ok := err.(net.Error)
+	return ok && (nerr.Temporary() || nerr.Timeout())
+}
+
+// sleep waits for d or until ctx is done, whichever is first
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,138 @@
+package zapi
+
+import (
+	"context"
+	"crypto/x509"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestRESTRetry(t *testing.T) {
+	var calls int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch atomic.AddInt32(&calls, 1) {
+		case 1:
+			w.Header().Set("Retry-After", "0")
+			http.Error(w, "slow down", http.StatusTooManyRequests)
+		case 2:
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		default:
+			_, _ = w.Write([]byte(`{"request_id":"abc"}`))
+		}
+	}))
+	defer srv.Close()
+
+	policy := RetryPolicy{
+		Backoff: Backoff{Initial: time.Millisecond},
+	}
+
+	client := NewRESTv1(nil, WithRestBaseURL(srv.URL), WithRetry(policy))
+
+	result, err := client.Result(context.Background(), "abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.RequestId != "abc" {
+		t.Errorf("unexpected request_id: %s", result.RequestId)
+	}
+
+	if calls != 3 {
+		t.Errorf("expected 3 calls, got %d", calls)
+	}
+
+	// Query is not retried by default
+
+	atomic.StoreInt32(&calls, 0)
+	if _, err = client.Query(context.Background(), queryRequest); err == nil {
+		t.Error("expected error")
+	}
+
+	if calls != 1 {
+		t.Errorf("expected 1 call, got %d", calls)
+	}
+}
+
+func TestRetryPolicy(t *testing.T) {
+	var p *RetryPolicy
+	if n := p.attempts(true); n != 1 {
+		t.Errorf("nil policy should make 1 attempt, got %d", n)
+	}
+
+	p = &DefaultRetryPolicy
+	if n := p.attempts(false); n != 1 {
+		t.Errorf("non-idempotent call should make 1 attempt, got %d", n)
+	}
+
+	if !p.retryCode(status.Code(status.Error(codes.Unavailable, ""))) {
+		t.Error("Unavailable should be retried")
+	}
+
+	if p.retryCode(codes.InvalidArgument) {
+		t.Error("InvalidArgument should not be retried")
+	}
+
+	if d, ok := parseRetryAfter("2"); !ok || d != 2*time.Second {
+		t.Errorf("unexpected Retry-After: %v", d)
+	}
+
+	if _, ok := parseRetryAfter(time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)); !ok {
+		t.Error("failed to parse http date Retry-After")
+	}
+
+	if _, ok := parseRetryAfter("soon"); ok {
+		t.Error("parsed invalid Retry-After")
+	}
+
+	if d := p.delay(0, "3600"); d != p.Backoff.Max {
+		t.Errorf("expected Retry-After to be capped at %v, got %v", p.Backoff.Max, d)
+	}
+}
+
+// failingTransport fails every request with err
+type failingTransport struct {
+	err   error
+	calls int32
+}
+
+func (f *failingTransport) RoundTrip(*http.Request) (*http.Response, error) {
+	atomic.AddInt32(&f.calls, 1)
+	return nil, f.err
+}
+
+func TestRESTRetryNetErr(t *testing.T) {
+	for _, tc := range []struct {
+		err   error
+		calls int32
+	}{
+		{err: io.ErrUnexpectedEOF, calls: 3},
+		{err: &net.OpError{Op: "read", Err: syscall.ECONNRESET}, calls: 3},
+		{err: &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, calls: 1},
+		{err: x509.UnknownAuthorityError{}, calls: 1},
+	} {
+		ft := failingTransport{err: tc.err}
+
+		client := NewRESTv1(nil,
+			WithTransport(&ft),
+			WithRetry(RetryPolicy{Backoff: Backoff{Initial: time.Millisecond}}),
+		)
+
+		if _, err := client.Result(context.Background(), "abc"); err == nil {
+			t.Errorf("%v: expected error", tc.err)
+		}
+
+		if ft.calls != tc.calls {
+			t.Errorf("%v: expected %d calls, got %d", tc.err, tc.calls, ft.calls)
+		}
+	}
+}
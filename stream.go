@@ -0,0 +1,360 @@
+package zapi
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	msg "zvelo.io/msg/msgpb"
+)
+
+// DefaultDedupeSize is the number of request IDs remembered by resilient
+// streams to drop duplicate results unless overridden with WithDedupeSize
+const DefaultDedupeSize = 10000
+
+// A ReconnectEvent describes a change in the connection of a resilient stream
+type ReconnectEvent struct {
+	// Attempt is the number of consecutive reconnect attempts, starting at 1.
+	// It is 0 when the stream was first disconnected.
+	Attempt int
+
+	// Err is the error that caused the disconnect or the failed reconnect. It
+	// is nil when Connected is true.
+	Err error
+
+	// Delay is how long until the next reconnect attempt
+	Delay time.Duration
+
+	// Connected is true when the stream was successfully reconnected
+	Connected bool
+}
+
+// A ReconnectHook is called synchronously with each ReconnectEvent
+type ReconnectHook func(ReconnectEvent)
+
+type streamOptions struct {
+	backoff    Backoff
+	hook       ReconnectHook
+	dedupeSize int
+	orphanSize int
+}
+
+// A StreamOption configures a resilient stream
+type StreamOption func(*streamOptions)
+
+// WithStreamBackoff returns a StreamOption that controls the delay between
+// reconnect attempts. If not specified, DefaultBackoff is used.
+func WithStreamBackoff(val Backoff) StreamOption {
+	return func(o *streamOptions) {
+		o.backoff = val
+	}
+}
+
+// WithReconnectHook returns a StreamOption that causes fn to be called when
+// the stream disconnects and reconnects
+func WithReconnectHook(fn ReconnectHook) StreamOption {
+	return func(o *streamOptions) {
+		o.hook = fn
+	}
+}
+
+// WithDedupeSize returns a StreamOption that sets how many request IDs are
+// remembered to drop results that were already delivered
+func WithDedupeSize(val int) StreamOption {
+	if val <= 0 {
+		val = DefaultDedupeSize
+	}
+
+	return func(o *streamOptions) {
+		o.dedupeSize = val
+	}
+}
+
+func streamDefaults(opts []StreamOption) streamOptions {
+	o := streamOptions{
+		backoff:    DefaultBackoff,
+		dedupeSize: DefaultDedupeSize,
+		orphanSize: DefaultOrphanSize,
+	}
+
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return o
+}
+
+func (o streamOptions) event(e ReconnectEvent) {
+	if o.hook != nil {
+		o.hook(e)
+	}
+}
+
+// retryableStreamErr returns whether a stream that failed with err should be
+// reopened. Only lost connections, idle streams, 5xx and 429 responses and
+// transient gRPC status codes are retried. Authentication failures, invalid responses and
+// the like are returned to the caller.
+func retryableStreamErr(err error) bool {
+	if uerr, ok := err.(*url.Error); ok {
+		err = uerr.Err
+	}
+
+	err = errors.Cause(err)
+
+	if err == io.EOF || err == io.ErrUnexpectedEOF || err == ErrStreamIdle {
+		return true
+	}
+
+	if herr, ok := err.(*HTTPError); ok {
+		return herr.StatusCode == http.StatusTooManyRequests || herr.StatusCode >= 500
+	}
+
+	if _, ok := err.(net.Error); ok {
+		return true
+	}
+
+	s, ok := status.FromError(err)
+	if !ok {
+		return false
+	}
+
+	switch s.Code() {
+	case codes.Unavailable, codes.ResourceExhausted, codes.Aborted, codes.Internal:
+		return true
+	}
+
+	return false
+}
+
+// dedupe remembers the completion state of a fixed number of request IDs
+type dedupe struct {
+	size     int
+	complete map[string]bool
+	order    []string
+}
+
+func newDedupe(size int) *dedupe {
+	return &dedupe{
+		size:     size,
+		complete: map[string]bool{},
+	}
+}
+
+// seen returns true if result was already delivered. An incomplete result is
+// not a duplicate of a later complete result.
+func (d *dedupe) seen(result *msg.QueryResult) bool {
+	if result == nil || result.RequestId == "" {
+		return false
+	}
+
+	complete := IsComplete(result)
+
+	done, ok := d.complete[result.RequestId]
+	if ok && (done || !complete) {
+		return true
+	}
+
+	if !ok {
+		if len(d.order) >= d.size {
+			delete(d.complete, d.order[0])
+			d.order = d.order[1:]
+		}
+		d.order = append(d.order, result.RequestId)
+	}
+
+	d.complete[result.RequestId] = complete
+
+	return false
+}
+
+// reconnect calls open until it succeeds, returns a non-retryable error or ctx
+// is done
+func reconnect(ctx context.Context, o streamOptions, cause error, open func() error) error {
+	delay := o.backoff.Delay(0)
+	o.event(ReconnectEvent{Err: cause, Delay: delay})
+
+	for attempt := 1; ; attempt++ {
+		if err := sleep(ctx, delay); err != nil {
+			return err
+		}
+
+		err := open()
+		if err == nil {
+			o.event(ReconnectEvent{Attempt: attempt, Connected: true})
+			return nil
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if !retryableStreamErr(err) {
+			return err
+		}
+
+		delay = o.backoff.Delay(attempt)
+		o.event(ReconnectEvent{Attempt: attempt, Err: err, Delay: delay})
+	}
+}
+
+type resilientRESTv1Stream struct {
+	ctx     context.Context
+	client  RESTv1Client
+	options streamOptions
+	stream  RESTv1StreamClient
+	dedupe  *dedupe
+	err     error
+}
+
+// ResilientRESTv1Stream returns a RESTv1StreamClient that transparently
+// reopens the stream with backoff when the connection is lost. Results that
+// were already delivered are dropped. Recv only returns an error when ctx is
+// done or the stream fails with a non-retryable error.
+func ResilientRESTv1Stream(ctx context.Context, client RESTv1Client, opts ...StreamOption) (RESTv1StreamClient, error) {
+	s := resilientRESTv1Stream{
+		ctx:     ctx,
+		client:  client,
+		options: streamDefaults(opts),
+	}
+	s.dedupe = newDedupe(s.options.dedupeSize)
+
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+func (s *resilientRESTv1Stream) open() error {
+	stream, err := s.client.Stream(s.ctx)
+	if err != nil {
+		return err
+	}
+
+	s.stream = stream
+	return nil
+}
+
+func (s *resilientRESTv1Stream) close() {
+	if c, ok := s.stream.(io.Closer); ok {
+		_ = c.Close() // #nosec
+	}
+	s.stream = nil
+}
+
+func (s *resilientRESTv1Stream) Recv() (*msg.QueryResult, error) {
+	for {
+		if s.err != nil {
+			return nil, s.err
+		}
+
+		result, err := s.stream.Recv()
+		if err == nil {
+			if s.dedupe.seen(result) {
+				continue
+			}
+
+			return result, nil
+		}
+
+		s.close()
+
+		if s.ctx.Err() != nil {
+			err = s.ctx.Err()
+		} else if retryableStreamErr(err) {
+			err = reconnect(s.ctx, s.options, err, s.open)
+		}
+
+		if err != nil {
+			s.err = err
+		}
+	}
+}
+
+type resilientGRPCv1Stream struct {
+	msg.APIv1_StreamClient
+	ctx     context.Context
+	cancel  context.CancelFunc
+	client  GRPCv1Client
+	options streamOptions
+	dedupe  *dedupe
+	err     error
+}
+
+// ResilientGRPCv1Stream returns a msg.APIv1_StreamClient that transparently
+// reopens the stream with backoff when it fails with a retryable status code
+// (e.g. Unavailable after a server restart). Results that were already
+// delivered are dropped. Recv only returns an error when ctx is done or the
+// stream fails with a non-retryable error.
+func ResilientGRPCv1Stream(ctx context.Context, client GRPCv1Client, opts ...StreamOption) (msg.APIv1_StreamClient, error) {
+	s := resilientGRPCv1Stream{
+		ctx:     ctx,
+		client:  client,
+		options: streamDefaults(opts),
+	}
+	s.dedupe = newDedupe(s.options.dedupeSize)
+
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+func (s *resilientGRPCv1Stream) open() error {
+	ctx, cancel := context.WithCancel(s.ctx)
+
+	stream, err := s.client.Stream(ctx, nil)
+	if err != nil {
+		cancel()
+		return err
+	}
+
+	s.APIv1_StreamClient = stream
+	s.cancel = cancel
+	return nil
+}
+
+func (s *resilientGRPCv1Stream) close() {
+	if s.cancel != nil {
+		s.cancel()
+		s.cancel = nil
+	}
+}
+
+func (s *resilientGRPCv1Stream) Recv() (*msg.QueryResult, error) {
+	for {
+		if s.err != nil {
+			return nil, s.err
+		}
+
+		result, err := s.APIv1_StreamClient.Recv()
+		if err == nil {
+			if s.dedupe.seen(result) {
+				continue
+			}
+
+			return result, nil
+		}
+
+		s.close()
+
+		if s.ctx.Err() != nil {
+			err = s.ctx.Err()
+		} else if retryableStreamErr(err) {
+			err = reconnect(s.ctx, s.options, err, s.open)
+		}
+
+		if err != nil {
+			s.err = err
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package zapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/empty"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	msg "zvelo.io/msg/msgpb"
+)
+
+func TestResilientRESTv1Stream(t *testing.T) {
+	var conns int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		item := func(reqID string) {
+			fmt.Fprintf(w, `{"result":{"request_id":%q,"query_status":{"complete":true}}}`+"\n", reqID)
+		}
+
+		switch atomic.AddInt32(&conns, 1) {
+		case 1:
+			item("a")
+		case 2:
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		default:
+			item("a")
+			item("b")
+		}
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var events []ReconnectEvent
+
+	client := NewRESTv1(nil, WithRestBaseURL(srv.URL))
+	stream, err := ResilientRESTv1Stream(ctx, client,
+		WithStreamBackoff(Backoff{Initial: time.Millisecond}),
+		WithReconnectHook(func(e ReconnectEvent) { events = append(events, e) }),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expect := range []string{"a", "b"} {
+		result, err := stream.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if result.RequestId != expect {
+			t.Errorf("expected request_id %q, got %q", expect, result.RequestId)
+		}
+	}
+
+	if len(events) != 3 || events[0].Attempt != 0 || events[1].Err == nil || !events[2].Connected {
+		t.Errorf("unexpected events: %+v", events)
+	}
+
+	cancel()
+
+	if _, err = stream.Recv(); err != context.Canceled {
+		t.Errorf("expected context.Canceled, got: %v", err)
+	}
+}
+
+func TestResilientRESTv1StreamIdle(t *testing.T) {
+	var conns int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		item := func(reqID string) {
+			fmt.Fprintf(w, `{"result":{"request_id":%q,"query_status":{"complete":true}}}`+"\n", reqID)
+		}
+
+		item("a")
+		if atomic.AddInt32(&conns, 1) > 1 {
+			item("b")
+		}
+		w.(http.Flusher).Flush()
+
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client := NewRESTv1(nil, WithRestBaseURL(srv.URL), WithStreamIdleTimeout(50*time.Millisecond))
+	stream, err := ResilientRESTv1Stream(ctx, client, WithStreamBackoff(Backoff{Initial: time.Millisecond}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expect := range []string{"a", "b"} {
+		result, err := stream.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if result.RequestId != expect {
+			t.Errorf("expected request_id %q, got %q", expect, result.RequestId)
+		}
+	}
+
+	if n := atomic.LoadInt32(&conns); n != 2 {
+		t.Errorf("expected 2 connections, got %d", n)
+	}
+}
+
+func TestResilientRESTv1StreamUnauthorized(t *testing.T) {
+	var conns int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&conns, 1) == 1 {
+			fmt.Fprintln(w, `{"result":{"request_id":"a","query_status":{"complete":true}}}`)
+			return
+		}
+
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client := NewRESTv1(nil, WithRestBaseURL(srv.URL))
+	stream, err := ResilientRESTv1Stream(ctx, client, WithStreamBackoff(Backoff{Initial: time.Millisecond}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = stream.Recv(); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = stream.Recv()
+	if herr, ok := err.(*HTTPError); !ok || herr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected 401 HTTPError, got: %v", err)
+	}
+
+	if conns != 2 {
+		t.Errorf("expected 2 connections, got %d", conns)
+	}
+}
+
+func TestRetryableStreamErr(t *testing.T) {
+	for _, tc := range []struct {
+		err       error
+		retryable bool
+	}{
+		{err: io.EOF, retryable: true},
+		{err: io.ErrUnexpectedEOF, retryable: true},
+		{err: ErrStreamIdle, retryable: true},
+		{err: &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, retryable: true},
+		{err: &HTTPError{StatusCode: http.StatusServiceUnavailable}, retryable: true},
+		{err: &HTTPError{StatusCode: http.StatusTooManyRequests}, retryable: true},
+		{err: &HTTPError{StatusCode: http.StatusForbidden}},
+		{err: &json.SyntaxError{}},
+		{err: status.Error(codes.Unavailable, ""), retryable: true},
+		{err: status.Error(codes.Unauthenticated, "")},
+	} {
+		if retryable := retryableStreamErr(tc.err); retryable != tc.retryable {
+			t.Errorf("%#v: expected retryable %v, got %v", tc.err, tc.retryable, retryable)
+		}
+	}
+}
+
+type fakeGRPCStream struct {
+	msg.APIv1_StreamClient
+	results []*msg.QueryResult
+	err     error
+}
+
+func (s *fakeGRPCStream) Recv() (*msg.QueryResult, error) {
+	if len(s.results) == 0 {
+		return nil, s.err
+	}
+
+	result := s.results[0]
+	s.results = s.results[1:]
+	return result, nil
+}
+
+type reconnectingClient struct {
+	GRPCv1Client
+	streams []*fakeGRPCStream
+}
+
+func (c *reconnectingClient) Stream(ctx context.Context, in *empty.Empty, opts ...grpc.CallOption) (msg.APIv1_StreamClient, error) {
+	if len(c.streams) == 0 {
+		return nil, status.Error(codes.PermissionDenied, "denied")
+	}
+
+	s := c.streams[0]
+	c.streams = c.streams[1:]
+	return s, nil
+}
+
+func TestResilientGRPCv1Stream(t *testing.T) {
+	unavailable := status.Error(codes.Unavailable, "unavailable")
+
+	client := reconnectingClient{
+		streams: []*fakeGRPCStream{
+			{results: []*msg.QueryResult{complete("a")}, err: unavailable},
+			{results: []*msg.QueryResult{complete("a"), complete("b")}, err: unavailable},
+		},
+	}
+
+	var events []ReconnectEvent
+
+	stream, err := ResilientGRPCv1Stream(context.Background(), &client,
+		WithStreamBackoff(Backoff{Initial: time.Millisecond}),
+		WithReconnectHook(func(e ReconnectEvent) { events = append(events, e) }),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expect := range []string{"a", "b"} {
+		result, err := stream.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if result.RequestId != expect {
+			t.Errorf("expected request_id %q, got %q", expect, result.RequestId)
+		}
+	}
+
+	// the third Stream call fails with a non-retryable error
+	if _, err = stream.Recv(); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("expected PermissionDenied, got: %v", err)
+	}
+
+	if len(events) != 3 || !events[1].Connected || events[2].Err != unavailable {
+		t.Errorf("unexpected events: %+v", events)
+	}
+}
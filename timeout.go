@@ -0,0 +1,162 @@
+package zapi
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+)
+
+// A Method identifies a zveloAPI call
+type Method string
+
+// The zveloAPI calls that can be configured individually
+const (
+	MethodQuery   Method = "Query"
+	MethodResult  Method = "Result"
+	MethodSuggest Method = "Suggest"
+	MethodGraphQL Method = "GraphQL"
+	MethodStream  Method = "Stream"
+)
+
+// ErrStreamIdle is returned by Recv when no message was received on a stream
+// within the time set by WithStreamIdleTimeout
+var ErrStreamIdle = errors.New("stream idle timeout")
+
+// WithDefaultTimeout returns an Option that sets the deadline for each call
+// (other than Stream) made by either client to val from when the call starts.
+// It only applies if the call's context doesn't already have an earlier
+// deadline. When retries are enabled, val includes all attempts.
+func WithDefaultTimeout(val time.Duration) Option {
+	return func(o *options) {
+		o.timeout = val
+	}
+}
+
+// WithMethodTimeout returns an Option that overrides the timeout set with
+// WithDefaultTimeout for a single Method. A negative val disables the timeout
+// for the Method and 0 uses the default timeout. MethodStream is ignored, use WithStreamIdleTimeout instead.
+func WithMethodTimeout(method Method, val time.Duration) Option {
+	return func(o *options) {
+		if o.methodTimeouts == nil {
+			o.methodTimeouts = map[Method]time.Duration{}
+		}
+		o.methodTimeouts[method] = val
+	}
+}
+
+// WithStreamIdleTimeout returns an Option that causes streams from either
+// client to fail with ErrStreamIdle if no message is received for val.
+// Resilient streams will reconnect when this happens.
+func WithStreamIdleTimeout(val time.Duration) Option {
+	return func(o *options) {
+		o.streamIdleTimeout = val
+	}
+}
+
+// withTimeout returns a context with the deadline configured for method
+// unless ctx already has an earlier one
+func (o options) withTimeout(ctx context.Context, method Method) (context.Context, context.CancelFunc) {
+	d := o.timeout
+	if val := o.methodTimeouts[method]; val != 0 {
+		d = val
+	}
+
+	if d <= 0 || method == MethodStream {
+		return ctx, func() {}
+	}
+
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= d {
+		return ctx, func() {}
+	}
+
+	return context.WithTimeout(ctx, d)
+}
+
+// grpcMethod returns the Method of a full gRPC method name, e.g.
+// "/zvelo.msg.APIv1/Query"
+func grpcMethod(fullMethod string) Method {
+	return Method(fullMethod[strings.LastIndex(fullMethod, "/")+1:])
+}
+
+func timeoutUnaryInterceptor(o *options) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx, cancel := o.withTimeout(ctx, grpcMethod(method))
+		defer cancel()
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// idleTimer cancels a stream's context when it isn't reset in time
+type idleTimer struct {
+	timer  *time.Timer
+	cancel context.CancelFunc
+	d      time.Duration
+	fired  int32
+}
+
+func newIdleTimer(ctx context.Context, d time.Duration) (context.Context, *idleTimer) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	t := idleTimer{cancel: cancel, d: d}
+	t.timer = time.AfterFunc(d, func() {
+		atomic.StoreInt32(&t.fired, 1)
+		cancel()
+	})
+
+	return ctx, &t
+}
+
+// reset is called whenever a message is received
+func (t *idleTimer) reset() {
+	if t != nil && atomic.LoadInt32(&t.fired) == 0 {
+		t.timer.Reset(t.d)
+	}
+}
+
+// done stops the timer when the stream fails with err and returns
+// ErrStreamIdle instead if the failure was caused by the timer
+func (t *idleTimer) done(err error) error {
+	if t == nil {
+		return err
+	}
+
+	t.timer.Stop()
+	t.cancel()
+
+	if atomic.LoadInt32(&t.fired) == 1 {
+		return ErrStreamIdle
+	}
+
+	return err
+}
+
+func idleStreamInterceptor(d time.Duration) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		ctx, idle := newIdleTimer(ctx, d)
+
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			return nil, idle.done(err)
+		}
+
+		return &idleClientStream{ClientStream: stream, idle: idle}, nil
+	}
+}
+
+type idleClientStream struct {
+	grpc.ClientStream
+	idle *idleTimer
+}
+
+func (s *idleClientStream) RecvMsg(m interface{}) error {
+	if err := s.ClientStream.RecvMsg(m); err != nil {
+		return s.idle.done(err)
+	}
+
+	s.idle.reset()
+	return nil
+}
@@ -0,0 +1,84 @@
+package zapi
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/stream" {
+			fmt.Fprintf(w, `{"result":{"request_id":"abc"}}`+"\n")
+			w.(http.Flusher).Flush()
+		}
+
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	client := NewRESTv1(nil,
+		WithRestBaseURL(srv.URL),
+		WithDefaultTimeout(time.Hour),
+		WithMethodTimeout(MethodResult, 50*time.Millisecond),
+		WithStreamIdleTimeout(50*time.Millisecond),
+	)
+
+	ctx := context.Background()
+
+	if _, err := client.Result(ctx, "abc"); err == nil {
+		t.Error("expected deadline exceeded")
+	}
+
+	stream, err := client.Stream(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = stream.Recv(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = stream.Recv(); err != ErrStreamIdle {
+		t.Errorf("expected ErrStreamIdle, got: %v", err)
+	}
+
+	// an earlier deadline is kept
+	o := defaults(nil)
+	WithDefaultTimeout(time.Hour)(o)
+
+	short, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	tctx, tcancel := o.withTimeout(short, MethodQuery)
+	defer tcancel()
+
+	if tctx != short {
+		t.Error("expected context with earlier deadline to be unchanged")
+	}
+
+	tctx, tcancel = o.withTimeout(ctx, MethodQuery)
+	defer tcancel()
+
+	if deadline, ok := tctx.Deadline(); !ok || time.Until(deadline) < 59*time.Minute {
+		t.Errorf("expected default deadline, got: %v", deadline)
+	}
+
+	// 0 uses the default, negative disables
+	WithMethodTimeout(MethodQuery, 0)(o)
+	WithMethodTimeout(MethodSuggest, -1)(o)
+
+	tctx, tcancel = o.withTimeout(ctx, MethodQuery)
+	defer tcancel()
+
+	if deadline, ok := tctx.Deadline(); !ok || time.Until(deadline) < 59*time.Minute {
+		t.Errorf("expected default deadline, got: %v", deadline)
+	}
+
+	if tctx, _ = o.withTimeout(ctx, MethodSuggest); tctx != ctx {
+		t.Error("expected disabled timeout to leave context unchanged")
+	}
+}
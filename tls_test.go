@@ -0,0 +1,50 @@
+package zapi
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTLSConfig(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) == 0 {
+			http.Error(w, "client certificate required", http.StatusUnauthorized)
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"request_id":"abc"}`))
+	}))
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	srv.StartTLS()
+	defer srv.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+
+	client := NewRESTv1(nil,
+		WithRestBaseURL(srv.URL),
+		WithTransport(&http.Transport{}),
+		WithRootCAs(roots),
+		WithServerName("example.com"),
+		WithClientCertificate(srv.TLS.Certificates[0]),
+	)
+
+	result, err := client.Result(context.Background(), "abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.RequestId != "abc" {
+		t.Errorf("unexpected result: %v", result)
+	}
+
+	// without the private CA the server certificate can't be verified
+	client = NewRESTv1(nil, WithRestBaseURL(srv.URL), WithTransport(&http.Transport{}))
+	if _, err = client.Result(context.Background(), "abc"); err == nil {
+		t.Error("expected certificate verification error")
+	}
+}
@@ -6,10 +6,11 @@ import (
 
 	"golang.org/x/oauth2"
 	"zvelo.io/go-zapi/internal/zvelo"
+	"zvelo.io/go-zapi/logger"
 )
 
 type debugTokenSource struct {
-	io.Writer
+	log logger.Logger
 	src oauth2.TokenSource
 }
 
@@ -18,15 +19,29 @@ func (s debugTokenSource) Token() (*oauth2.Token, error) {
 
 	token, err := s.src.Token()
 
-	zvelo.DebugTiming(s, "Token", time.Since(start))
+	zvelo.DebugTiming(s.log, "Token", time.Since(start))
+
+	if err != nil {
+		s.log.Log(logger.Error, "error getting token", "error", err)
+	}
 
 	return token, err
 }
 
 // Debug returns an oauth2.TokenSource that will log timing info to w
 func Debug(w io.Writer, src oauth2.TokenSource) oauth2.TokenSource {
+	return Logger(logger.Color(w), src)
+}
+
+// Logger returns an oauth2.TokenSource that will log timing info and errors
+// to l
+func Logger(l logger.Logger, src oauth2.TokenSource) oauth2.TokenSource {
+	if l == nil {
+		l = logger.Discard
+	}
+
 	return debugTokenSource{
-		Writer: w,
-		src:    src,
+		log: l,
+		src: src,
 	}
 }
@@ -1,15 +1,15 @@
 package tokensource
 
 import (
-	"fmt"
 	"io"
 	"time"
 
 	"golang.org/x/oauth2"
+	"zvelo.io/go-zapi/logger"
 )
 
 type logTokenSource struct {
-	io.Writer
+	log logger.Logger
 	src oauth2.TokenSource
 }
 
@@ -19,9 +19,9 @@ func (s logTokenSource) Token() (*oauth2.Token, error) {
 	token, err := s.src.Token()
 
 	if err == nil {
-		fmt.Fprintf(s, "got token (%s)\n", time.Since(start))
+		s.log.Log(logger.Debug, "got token", "duration", time.Since(start))
 	} else {
-		fmt.Fprintf(s, "error getting token: %s (%s)\n", err, time.Since(start))
+		s.log.Log(logger.Error, "error getting token", "error", err, "duration", time.Since(start))
 	}
 
 	return token, err
@@ -29,11 +29,11 @@ func (s logTokenSource) Token() (*oauth2.Token, error) {
 
 var _ oauth2.TokenSource = (*logTokenSource)(nil)
 
-// Log returns an oauth2.TokenSource that will log debug information to the
-// writer
+// Log returns an oauth2.TokenSource that will log debug information to w in
+// logfmt. Use Logger to log to a filtered or redacted logger.Logger instead.
 func Log(w io.Writer, src oauth2.TokenSource) oauth2.TokenSource {
 	return logTokenSource{
-		Writer: w,
-		src:    src,
+		log: logger.Logfmt(w),
+		src: src,
 	}
 }
@@ -9,7 +9,7 @@ import (
 	"golang.org/x/oauth2"
 )
 
-func testLog(t *testing.T, buf *bytes.Buffer, ts oauth2.TokenSource, expectToken oauth2.Token, expectError, expectPrefix string) {
+func testLog(t *testing.T, buf *bytes.Buffer, ts oauth2.TokenSource, expectToken oauth2.Token, expectError, expectOutput string) {
 	t.Helper()
 
 	token, err := ts.Token()
@@ -24,7 +24,7 @@ func testLog(t *testing.T, buf *bytes.Buffer, ts oauth2.TokenSource, expectToken
 		t.Error("unexpected token")
 	}
 
-	if !strings.HasPrefix(buf.String(), expectPrefix) {
+	if !strings.Contains(buf.String(), expectOutput) {
 		t.Errorf("unexpected output: %s", buf.String())
 	}
 }
@@ -35,7 +35,7 @@ func TestLog(t *testing.T) {
 	var buf bytes.Buffer
 	ts := Log(&buf, TestTokenSource{token: &token})
 
-	testLog(t, &buf, ts, token, "", "got token (")
+	testLog(t, &buf, ts, token, "", `msg="got token"`)
 
 	buf.Reset()
 	ts = Log(&buf, TestTokenSource{
@@ -43,5 +43,5 @@ func TestLog(t *testing.T) {
 		err:   errors.New("token error"),
 	})
 
-	testLog(t, &buf, ts, token, "token error", "error getting token: token error (")
+	testLog(t, &buf, ts, token, "token error", `msg="error getting token" error="token error"`)
 }
@@ -0,0 +1,54 @@
+package tokensource
+
+import (
+	"time"
+
+	"golang.org/x/oauth2"
+	"google.golang.org/grpc/codes"
+
+	"zvelo.io/go-zapi/metrics"
+)
+
+type observedTokenSource struct {
+	observer metrics.Observer
+	src      oauth2.TokenSource
+}
+
+func (s observedTokenSource) Token() (*oauth2.Token, error) {
+	start := time.Now()
+
+	token, err := s.src.Token()
+
+	o := metrics.Observation{
+		Method:    "Token",
+		Transport: metrics.OAuth2,
+		Duration:  time.Since(start),
+	}
+
+	if err != nil {
+		o.Code = codes.Unknown
+		if rerr, ok := err.(*oauth2.RetrieveError); ok && rerr.Response != nil {
+			o.HTTPStatus = rerr.Response.StatusCode
+			o.Code = metrics.HTTPCode(o.HTTPStatus)
+			o.BytesReceived = int64(len(rerr.Body))
+		}
+	}
+
+	s.observer.Observe(o)
+
+	return token, err
+}
+
+// Observe returns an oauth2.TokenSource that will report every token fetched
+// from src to o. To only report tokens that are actually requested from the
+// server, wrap src before it is wrapped with oauth2.ReuseTokenSource.
+func Observe(o metrics.Observer, src oauth2.TokenSource) oauth2.TokenSource {
+	if o == nil {
+		o = metrics.Discard
+	}
+
+	return observedTokenSource{
+		observer: o,
+		src:      src,
+	}
+}
@@ -0,0 +1,41 @@
+package tokensource
+
+import (
+	"net/http"
+	"testing"
+
+	"golang.org/x/oauth2"
+	"google.golang.org/grpc/codes"
+
+	"zvelo.io/go-zapi/metrics"
+)
+
+func TestObserve(t *testing.T) {
+	var got []metrics.Observation
+	o := metrics.ObserverFunc(func(val metrics.Observation) { got = append(got, val) })
+
+	if _, err := Observe(o, TestTokenSource{token: &oauth2.Token{}}).Token(); err != nil {
+		t.Fatal(err)
+	}
+
+	rerr := oauth2.RetrieveError{
+		Response: &http.Response{StatusCode: http.StatusUnauthorized},
+		Body:     []byte("denied"),
+	}
+
+	if _, err := Observe(o, TestTokenSource{err: &rerr}).Token(); err == nil {
+		t.Fatal("expected error")
+	}
+
+	if len(got) != 2 {
+		t.Fatalf("expected 2 observations, got %d", len(got))
+	}
+
+	if got[0].Method != "Token" || got[0].Transport != metrics.OAuth2 || got[0].Code != codes.OK {
+		t.Errorf("unexpected observation: %+v", got[0])
+	}
+
+	if got[1].Code != codes.Unauthenticated || got[1].HTTPStatus != http.StatusUnauthorized || got[1].BytesReceived != 6 {
+		t.Errorf("unexpected observation: %+v", got[1])
+	}
+}
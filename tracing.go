@@ -0,0 +1,89 @@
+package zapi
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"zvelo.io/go-zapi/tracing"
+	msg "zvelo.io/msg/msgpb"
+)
+
+// WithTracer returns an Option that causes both clients to start a client span
+// with val for every call and to propagate it to zveloAPI with the W3C
+// traceparent and tracestate headers. Stream spans end once the stream is
+// established.
+func WithTracer(val tracing.Tracer) Option {
+	if val == nil {
+		val = tracing.Noop
+	}
+
+	return func(o *options) {
+		o.tracer = val
+	}
+}
+
+// startSpan starts the client span of a call to m
+func (o options) startSpan(ctx context.Context, m Method) (context.Context, tracing.Span) {
+	return tracing.Start(ctx, o.tracer, "zapi."+string(m), tracing.Client)
+}
+
+func requestIDs(replies *msg.QueryReplies) []string {
+	ids := make([]string, 0, len(replies.Reply))
+	for _, reply := range replies.Reply {
+		if reply != nil {
+			ids = append(ids, reply.RequestId)
+		}
+	}
+	return ids
+}
+
+// injectMD adds the traceparent and tracestate of the span in ctx to its
+// outgoing metadata
+func injectMD(ctx context.Context) context.Context {
+	sc := tracing.SpanFromContext(ctx).SpanContext()
+	if !sc.IsValid() {
+		return ctx
+	}
+
+	md, _ := metadata.FromOutgoingContext(ctx)
+	md = md.Copy()
+	md.Set(tracing.TraceParentHeader, sc.TraceParent())
+
+	if sc.TraceState != "" {
+		md.Set(tracing.TraceStateHeader, sc.TraceState)
+	} else {
+		delete(md, tracing.TraceStateHeader)
+	}
+
+	return metadata.NewOutgoingContext(ctx, md)
+}
+
+func tracingUnaryInterceptor(o *options) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx, span := o.startSpan(ctx, grpcMethod(method))
+
+		if in, ok := req.(*msg.RequestID); ok {
+			span.SetAttribute(tracing.AttrRequestID, in.RequestId)
+		}
+
+		err := invoker(injectMD(ctx), method, req, reply, cc, opts...)
+
+		if replies, ok := reply.(*msg.QueryReplies); ok && err == nil {
+			span.SetAttribute(tracing.AttrRequestIDs, requestIDs(replies))
+		}
+
+		span.End(err)
+		return err
+	}
+}
+
+func tracingStreamInterceptor(o *options) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		ctx, span := o.startSpan(ctx, grpcMethod(method))
+		stream, err := streamer(injectMD(ctx), desc, cc, method, opts...)
+		span.End(err)
+		return stream, err
+	}
+}
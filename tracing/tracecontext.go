@@ -0,0 +1,143 @@
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// W3C Trace Context header names. gRPC metadata uses the same keys.
+const (
+	TraceParentHeader = "traceparent"
+	TraceStateHeader  = "tracestate"
+)
+
+// ErrInvalidTraceParent is returned by ParseTraceParent when the value is
+// malformed
+var ErrInvalidTraceParent = errors.New("invalid traceparent")
+
+// A TraceID identifies a trace
+type TraceID [16]byte
+
+func (t TraceID) String() string {
+	return hex.EncodeToString(t[:])
+}
+
+// A SpanID identifies a span within a trace
+type SpanID [8]byte
+
+func (s SpanID) String() string {
+	return hex.EncodeToString(s[:])
+}
+
+// A SpanContext is the part of a span that is propagated across processes
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+
+	// TraceState is the vendor specific tracestate header value, it is
+	// propagated unmodified
+	TraceState string
+}
+
+// IsValid returns whether both the TraceID and SpanID are non-zero
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != TraceID{} && sc.SpanID != SpanID{}
+}
+
+// TraceParent returns the traceparent header value of sc
+func (sc SpanContext) TraceParent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + flags
+}
+
+// traceParentLen is the length of a version 00 traceparent
+const traceParentLen = 55
+
+// ParseTraceParent parses a traceparent and its accompanying tracestate
+// header value
+func ParseTraceParent(traceparent, tracestate string) (SpanContext, error) {
+	var sc SpanContext
+
+	val := strings.TrimSpace(traceparent)
+
+	// later versions may append fields, but must be compatible with 00
+	if len(val) < traceParentLen || (len(val) > traceParentLen && val[traceParentLen] != '-') {
+		return sc, ErrInvalidTraceParent
+	}
+
+	parts := strings.Split(val[:traceParentLen], "-")
+	if len(parts) != 4 || parts[0] == "ff" || (parts[0] == "00" && len(val) != traceParentLen) {
+		return sc, ErrInvalidTraceParent
+	}
+
+	var version, flags [1]byte
+	if err := decodeHex(version[:], parts[0]); err != nil {
+		return sc, err
+	}
+
+	if err := decodeHex(sc.TraceID[:], parts[1]); err != nil {
+		return sc, err
+	}
+
+	if err := decodeHex(sc.SpanID[:], parts[2]); err != nil {
+		return sc, err
+	}
+
+	if err := decodeHex(flags[:], parts[3]); err != nil {
+		return sc, err
+	}
+
+	if !sc.IsValid() {
+		return SpanContext{}, ErrInvalidTraceParent
+	}
+
+	sc.Sampled = flags[0]&1 == 1
+	sc.TraceState = strings.TrimSpace(tracestate)
+
+	return sc, nil
+}
+
+// decodeHex decodes the lowercase hex s into dst, which it must fill exactly
+func decodeHex(dst []byte, s string) error {
+	if len(s) != hex.EncodedLen(len(dst)) || strings.ToLower(s) != s {
+		return ErrInvalidTraceParent
+	}
+
+	if _, err := hex.Decode(dst, []byte(s)); err != nil {
+		return ErrInvalidTraceParent
+	}
+
+	return nil
+}
+
+// Inject sets the traceparent and tracestate headers of h from the span held
+// by ctx, if it is valid
+func Inject(ctx context.Context, h http.Header) {
+	sc := SpanFromContext(ctx).SpanContext()
+	if !sc.IsValid() {
+		return
+	}
+
+	h.Set(TraceParentHeader, sc.TraceParent())
+
+	if sc.TraceState != "" {
+		h.Set(TraceStateHeader, sc.TraceState)
+	} else {
+		h.Del(TraceStateHeader)
+	}
+}
+
+// Extract returns the span context propagated in h, if any
+func Extract(h http.Header) (SpanContext, bool) {
+	sc, err := ParseTraceParent(h.Get(TraceParentHeader), strings.Join(h[http.CanonicalHeaderKey(TraceStateHeader)], ","))
+	return sc, err == nil
+}
@@ -0,0 +1,89 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestParseTraceParent(t *testing.T) {
+	sc, err := ParseTraceParent(traceparent, "congo=t61rcWkgMzE")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.SpanID.String() != "00f067aa0ba902b7" ||
+		!sc.Sampled || sc.TraceState != "congo=t61rcWkgMzE" {
+		t.Errorf("unexpected span context: %+v", sc)
+	}
+
+	if sc.TraceParent() != traceparent {
+		t.Errorf("unexpected traceparent: %s", sc.TraceParent())
+	}
+
+	if _, err = ParseTraceParent("01"+traceparent[2:]+"-future", ""); err != nil {
+		t.Errorf("expected future version to parse: %v", err)
+	}
+
+	for _, val := range []string{
+		"",
+		traceparent + "-extra",
+		"ff" + traceparent[2:],
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-0x",
+		"00_4bf92f3577b34da6a3ce929d0e0e4736_00f067aa0ba902b7_01",
+	} {
+		if _, err = ParseTraceParent(val, ""); err != ErrInvalidTraceParent {
+			t.Errorf("%q: expected ErrInvalidTraceParent, got %v", val, err)
+		}
+	}
+}
+
+type span struct {
+	noopSpan
+	sc SpanContext
+}
+
+func (s span) SpanContext() SpanContext { return s.sc }
+
+type tracer struct {
+	sc SpanContext
+}
+
+func (t tracer) Start(ctx context.Context, _ string, _ SpanKind) (context.Context, Span) {
+	return ctx, span{sc: t.sc}
+}
+
+func TestInjectExtract(t *testing.T) {
+	sc, err := ParseTraceParent(traceparent, "a=b")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := http.Header{}
+	Inject(context.Background(), h)
+	if len(h) != 0 {
+		t.Errorf("expected nothing to be injected without a span: %v", h)
+	}
+
+	ctx, _ := Start(context.Background(), tracer{sc: sc}, "test", Client)
+	Inject(ctx, h)
+
+	if h.Get(TraceParentHeader) != traceparent || h.Get(TraceStateHeader) != "a=b" {
+		t.Errorf("unexpected headers: %v", h)
+	}
+
+	got, ok := Extract(h)
+	if !ok || got != sc {
+		t.Errorf("unexpected span context: %+v", got)
+	}
+
+	ctx = ContextWithRemoteParent(context.Background(), sc)
+	if got, ok = RemoteParent(ctx); !ok || got != sc {
+		t.Errorf("unexpected remote parent: %+v", got)
+	}
+}
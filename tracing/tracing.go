@@ -0,0 +1,106 @@
+// Package tracing provides the Tracer hook that the zapi clients and
+// callback.Middleware use to start spans, and the W3C Trace Context
+// propagation of those spans to and from zveloAPI
+package tracing // import "zvelo.io/go-zapi/tracing"
+
+import (
+	"context"
+)
+
+// Span attributes recorded by the zapi clients and callback.Middleware
+const (
+	// AttrRequestID is the request ID of a Result call or a callback
+	AttrRequestID = "zvelo.request_id"
+
+	// AttrRequestIDs are the request IDs, a []string, returned by a Query call
+	AttrRequestIDs = "zvelo.request_ids"
+)
+
+// A SpanKind describes the relationship of a span to the remote side
+type SpanKind int
+
+// SpanKinds started by this package
+const (
+	// Client spans are started for every call to zveloAPI
+	Client SpanKind = iota
+
+	// Server spans are started for every callback received
+	Server
+)
+
+// A Span is a single operation within a trace
+type Span interface {
+	// SpanContext returns the context that is propagated to the remote side.
+	// If it isn't valid, nothing is propagated.
+	SpanContext() SpanContext
+
+	SetAttribute(key string, val interface{})
+
+	// End completes the span. err is nil if the operation succeeded.
+	End(err error)
+}
+
+// A Tracer starts Spans. It is the hook used to connect the zapi clients and
+// callback.Middleware to a tracing system, e.g. by adapting an OpenTelemetry
+// tracer. Implementations must be safe for concurrent use.
+type Tracer interface {
+	// Start starts a span named name that is a child of the span in ctx, if
+	// any. Server spans should instead be children of RemoteParent(ctx), if
+	// present. The returned context is passed to the operation.
+	Start(ctx context.Context, name string, kind SpanKind) (context.Context, Span)
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SpanContext() SpanContext         { return SpanContext{} }
+func (noopSpan) SetAttribute(string, interface{}) {}
+func (noopSpan) End(error)                        {}
+
+type noop struct{}
+
+func (noop) Start(ctx context.Context, _ string, _ SpanKind) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+// Noop is a Tracer that doesn't record or propagate anything
+var Noop Tracer = noop{}
+
+type key int
+
+const (
+	spanKey key = iota
+	remoteParentKey
+)
+
+// Start starts a span with t and returns a context that holds it so that it
+// can be retrieved with SpanFromContext and propagated with Inject
+func Start(ctx context.Context, t Tracer, name string, kind SpanKind) (context.Context, Span) {
+	if t == nil {
+		t = Noop
+	}
+
+	ctx, span := t.Start(ctx, name, kind)
+	return context.WithValue(ctx, spanKey, span), span
+}
+
+// SpanFromContext returns the span started with Start that is held by ctx or
+// a Span that does nothing
+func SpanFromContext(ctx context.Context) Span {
+	if span, ok := ctx.Value(spanKey).(Span); ok {
+		return span
+	}
+	return noopSpan{}
+}
+
+// ContextWithRemoteParent returns a context that holds sc, the span context
+// that was extracted from an incoming request
+func ContextWithRemoteParent(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteParentKey, sc)
+}
+
+// RemoteParent returns the span context held by ctx, if any, that was
+// extracted from an incoming request
+func RemoteParent(ctx context.Context) (SpanContext, bool) {
+	sc, ok := ctx.Value(remoteParentKey).(SpanContext)
+	return sc, ok
+}
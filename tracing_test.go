@@ -0,0 +1,143 @@
+package zapi
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"zvelo.io/go-zapi/tracing"
+	msg "zvelo.io/msg/msgpb"
+)
+
+type testSpan struct {
+	name  string
+	sc    tracing.SpanContext
+	attrs map[string]interface{}
+	ended bool
+}
+
+func (s *testSpan) SpanContext() tracing.SpanContext         { return s.sc }
+func (s *testSpan) SetAttribute(key string, val interface{}) { s.attrs[key] = val }
+func (s *testSpan) End(error)                                { s.ended = true }
+
+// testTracer starts spans with sequential span IDs in a single trace
+type testTracer struct {
+	mu    sync.Mutex
+	spans []*testSpan
+}
+
+func (t *testTracer) Start(ctx context.Context, name string, _ tracing.SpanKind) (context.Context, tracing.Span) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s := testSpan{name: name, attrs: map[string]interface{}{}}
+	s.sc.TraceID[0] = 1
+	s.sc.SpanID[7] = byte(len(t.spans) + 1)
+	s.sc.TraceState = "zvelo=test"
+	t.spans = append(t.spans, &s)
+
+	return ctx, &s
+}
+
+func TestRESTTracing(t *testing.T) {
+	headers := make(chan http.Header, 1)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers <- r.Header
+		w.Header().Set("Content-Type", contentTypeJSON)
+		_, _ = w.Write([]byte(`{"reply":[{"requestId":"abc"},{"requestId":"def"}]}`)) // #nosec
+	}))
+	defer srv.Close()
+
+	var tracer testTracer
+
+	client := NewRESTv1(nil, WithRestBaseURL(srv.URL), WithTracer(&tracer))
+
+	if _, err := client.Query(context.Background(), &msg.QueryRequests{Url: []string{"a", "b"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tracer.spans) != 1 {
+		t.Fatalf("expected 1 span, got %d", len(tracer.spans))
+	}
+
+	span := tracer.spans[0]
+	if span.name != "zapi.Query" || !span.ended ||
+		!reflect.DeepEqual(span.attrs[tracing.AttrRequestIDs], []string{"abc", "def"}) {
+		t.Errorf("unexpected span: %+v", span)
+	}
+
+	h := <-headers
+	if h.Get("traceparent") != span.sc.TraceParent() || h.Get("tracestate") != "zvelo=test" {
+		t.Errorf("unexpected trace headers: %v", h)
+	}
+}
+
+func TestGRPCTracing(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	incoming := make(chan metadata.MD, 1)
+
+	srv := grpc.NewServer(grpc.UnknownServiceHandler(func(_ interface{}, stream grpc.ServerStream) error {
+		md, _ := metadata.FromIncomingContext(stream.Context())
+		incoming <- md
+
+		var in msg.RequestID
+		if err := stream.RecvMsg(&in); err != nil {
+			return err
+		}
+
+		return stream.SendMsg(&msg.QueryResult{RequestId: in.RequestId})
+	}))
+	go func() { _ = srv.Serve(lis) }()
+	defer srv.Stop()
+
+	var tracer testTracer
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-test", "value")
+	client, err := NewGRPCv1(nil,
+		WithoutTLS(),
+		WithGrpcTarget(lis.Addr().String()),
+		WithTracer(&tracer),
+	).Dial(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close() // #nosec
+
+	if _, err = client.Result(ctx, &msg.RequestID{RequestId: "abc"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tracer.spans) != 1 {
+		t.Fatalf("expected 1 span, got %d", len(tracer.spans))
+	}
+
+	span := tracer.spans[0]
+	if span.name != "zapi.Result" || !span.ended || span.attrs[tracing.AttrRequestID] != "abc" {
+		t.Errorf("unexpected span: %+v", span)
+	}
+
+	md := <-incoming
+	if get(md, "traceparent") != span.sc.TraceParent() || get(md, "tracestate") != "zvelo=test" ||
+		get(md, "x-test") != "value" {
+		t.Errorf("unexpected metadata: %v", md)
+	}
+}
+
+func get(md metadata.MD, key string) string {
+	if vals := md.Get(key); len(vals) > 0 {
+		return vals[0]
+	}
+	return ""
+}
@@ -2,14 +2,17 @@ package zapi
 
 import (
 	"net/http"
+	"time"
 
 	"zvelo.io/go-zapi/internal/zvelo"
+	"zvelo.io/go-zapi/tracing"
 )
 
 var _ http.RoundTripper = (*transport)(nil)
 
 type transport struct {
 	*options
+	endpoints *restEndpoints
 }
 
 func cloneRequest(r *http.Request) *http.Request {
@@ -26,36 +29,85 @@ func cloneRequest(r *http.Request) *http.Request {
 
 type key int
 
-const debugDumpResponseBodyKey key = 0
+const (
+	debugDumpResponseBodyKey key = iota
+	retryQueryKey
+	methodKey
+)
 
 func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
 	req = cloneRequest(req) // per RoundTripper contract
 
 	req.Header.Set("User-Agent", UserAgent)
+	tracing.Inject(req.Context(), req.Header)
+
+	start := time.Now()
 
 	if t.TokenSource != nil {
 		token, err := t.Token()
 		if err != nil {
+			t.observe(req, start, err)
 			return nil, err
 		}
 
 		token.SetAuthHeader(req)
 	}
 
-	req = zvelo.DebugRequestTiming(t.debug, req)
-	zvelo.DebugRequestOut(t.debug, req)
+	t.acceptGzip(req)
 
-	res, err := t.transport.RoundTrip(req)
+	// pick the endpoint before dumping the request so that the dump shows
+	// where it is actually sent
+	endpoint := t.pickEndpoint(req)
+
+	req = zvelo.DebugRequestTiming(t.log, req)
+	zvelo.DebugRequestOut(t.log, req)
+
+	if err := t.compress(req); err != nil {
+		t.observe(req, start, err)
+		return nil, err
+	}
+
+	res, err := t.roundTrip(req, endpoint)
 	if err != nil {
+		t.observe(req, start, err)
 		return nil, err
 	}
 
+	t.observeBody(req, res, start)
+	t.decompress(res)
+
 	dumpRespBody := true
 	if val, ok := req.Context().Value(debugDumpResponseBodyKey).(bool); ok {
 		dumpRespBody = val
 	}
 
-	zvelo.DebugResponse(t.debug, res, dumpRespBody)
+	zvelo.DebugResponse(t.log, res, dumpRespBody)
 
 	return res, nil
 }
+
+// pickEndpoint points req at the healthiest endpoint, if several are
+// configured, and returns its index
+func (t *transport) pickEndpoint(req *http.Request) int {
+	if t.endpoints == nil {
+		return -1
+	}
+
+	i := t.endpoints.pick()
+	t.endpoints.rewrite(req, i)
+	return i
+}
+
+// roundTrip sends req and reports the result to endpoint i, as returned by
+// pickEndpoint
+func (t *transport) roundTrip(req *http.Request, i int) (*http.Response, error) {
+	if t.endpoints == nil {
+		return t.transport.RoundTrip(req)
+	}
+
+	start := t.endpoints.now()
+	res, err := t.transport.RoundTrip(req)
+	t.endpoints.report(i, restFailure(res, err), t.endpoints.now().Sub(start))
+
+	return res, err
+}
@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"html/template"
 	"io"
-	"io/ioutil"
 	"net/http"
 	"os"
 	"strings"
@@ -13,6 +12,7 @@ import (
 
 	zapi "zvelo.io/go-zapi"
 	"zvelo.io/go-zapi/internal/zvelo"
+	"zvelo.io/go-zapi/logger"
 
 	"github.com/pkg/browser"
 	"github.com/pkg/errors"
@@ -46,8 +46,11 @@ type userAccreditor struct {
 	open               bool
 	authCodeURLHandler AuthCodeURLHandler
 	ctx                context.Context
-	debug              io.Writer
+	log                logger.Logger
 	ignoreErrors       bool
+	redactHeaders      []string
+	redactFields       []string
+	noRedact           bool
 }
 
 var _ oauth2.TokenSource = (*userAccreditor)(nil)
@@ -166,12 +169,37 @@ func WithoutOpen() Option {
 // WithDebug returns an option that causes incoming http.Requests to the
 // callback server to be logged to the writer.
 func WithDebug(val io.Writer) Option {
+	return WithLogger(logger.Color(val))
+}
+
+// WithLogger returns an option that causes incoming http.Requests to the
+// callback server to be logged to val.
+func WithLogger(val logger.Logger) Option {
 	if val == nil {
-		val = ioutil.Discard
+		val = logger.Discard
 	}
 
 	return func(a *userAccreditor) {
-		a.debug = val
+		a.log = val
+	}
+}
+
+// WithRedaction returns an Option that redacts the values of the headers and
+// the URL query, form and JSON fields from request dumps in addition to
+// logger.DefaultRedactHeaders and logger.DefaultRedactFields. By default, the
+// authorization code is redacted.
+func WithRedaction(headers, fields []string) Option {
+	return func(a *userAccreditor) {
+		a.redactHeaders = append(a.redactHeaders, headers...)
+		a.redactFields = append(a.redactFields, fields...)
+	}
+}
+
+// WithoutRedaction returns an Option that disables the redaction of secrets,
+// e.g. the authorization code, from request dumps
+func WithoutRedaction() Option {
+	return func(a *userAccreditor) {
+		a.noRedact = true
 	}
 }
 
@@ -184,10 +212,10 @@ func defaults(ctx context.Context, clientID, clientSecret string) *userAccredito
 			RedirectURL:  DefaultRedirectURL,
 			Scopes:       defaultScopes(),
 		},
-		addr:  DefaultCallbackAddr,
-		ctx:   ctx,
-		open:  true,
-		debug: ioutil.Discard,
+		addr: DefaultCallbackAddr,
+		ctx:  ctx,
+		open: true,
+		log:  logger.Discard,
 	}
 }
 
@@ -198,6 +226,11 @@ func TokenSource(ctx context.Context, clientID, clientSecret string, opts ...Opt
 	for _, opt := range opts {
 		opt(a)
 	}
+
+	if !a.noRedact {
+		a.log = logger.RedactDefaults(a.log, a.redactHeaders, a.redactFields)
+	}
+
 	return a
 }
 
@@ -253,7 +286,7 @@ type result struct {
 
 func (a *userAccreditor) handler(state string, ch chan<- result) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		zvelo.DebugRequest(a.debug, r)
+		zvelo.DebugRequest(a.log, r)
 
 		if state == "" || state != r.URL.Query().Get("state") {
 			// don't return the result on the channel, this can happen when the
@@ -0,0 +1,106 @@
+package zapi
+
+import (
+	"context"
+	"time"
+
+	msg "zvelo.io/msg/msgpb"
+)
+
+// DefaultMaxWait is the longest WaitForResult will poll for a complete result
+// unless overridden with WithMaxWait
+const DefaultMaxWait = time.Minute
+
+type waitOptions struct {
+	backoff Backoff
+	maxWait time.Duration
+}
+
+// A WaitOption configures WaitForResult
+type WaitOption func(*waitOptions)
+
+// WithPollBackoff returns a WaitOption that controls how long WaitForResult
+// waits between calls to Result. If not specified, DefaultBackoff is used.
+func WithPollBackoff(val Backoff) WaitOption {
+	return func(o *waitOptions) {
+		o.backoff = val
+	}
+}
+
+// WithMaxWait returns a WaitOption that limits how long WaitForResult will
+// poll before returning an incomplete result. A value <= 0 causes
+// WaitForResult to poll until the context is done.
+func WithMaxWait(val time.Duration) WaitOption {
+	return func(o *waitOptions) {
+		o.maxWait = val
+	}
+}
+
+// A Resulter retrieves the result of a query. It is implemented by Client and
+// RESTv1Client. Use FromGRPCv1 to wait for results with a GRPCv1Client.
+type Resulter interface {
+	Result(ctx context.Context, reqID string, opts ...CallOption) (*msg.QueryResult, error)
+}
+
+var (
+	_ Resulter = Client(nil)
+	_ Resulter = RESTv1Client(nil)
+)
+
+// IsComplete returns whether result has finished processing
+func IsComplete(result *msg.QueryResult) bool {
+	return result != nil && result.QueryStatus != nil && result.QueryStatus.Complete
+}
+
+// WaitForResult polls Result for reqID until the returned QueryResult is
+// complete.
+//
+// If the maximum wait elapses before the result is complete, the last,
+// incomplete, result is returned without an error. Callers can use IsComplete
+// to distinguish this case. If ctx is done first, the last result (if any) is
+// returned along with ctx.Err().
+func WaitForResult(ctx context.Context, client Resulter, reqID string, opts ...WaitOption) (*msg.QueryResult, error) {
+	o := waitOptions{
+		backoff: DefaultBackoff,
+		maxWait: DefaultMaxWait,
+	}
+
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	pollCtx := ctx
+	if o.maxWait > 0 {
+		var cancel context.CancelFunc
+		pollCtx, cancel = context.WithTimeout(ctx, o.maxWait)
+		defer cancel()
+	}
+
+	var last *msg.QueryResult
+
+	for attempt := 0; ; attempt++ {
+		result, err := client.Result(pollCtx, reqID)
+		if err != nil {
+			if pollCtx.Err() == nil {
+				return last, err
+			}
+		} else {
+			last = result
+			if IsComplete(result) {
+				return result, nil
+			}
+		}
+
+		if pollCtx.Err() != nil || sleep(pollCtx, o.backoff.Delay(attempt)) != nil {
+			if ctx.Err() != nil {
+				return last, ctx.Err()
+			}
+
+			if last == nil {
+				return nil, pollCtx.Err()
+			}
+
+			return last, nil
+		}
+	}
+}
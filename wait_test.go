@@ -0,0 +1,70 @@
+package zapi
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	msg "zvelo.io/msg/msgpb"
+)
+
+type pollingClient struct {
+	RESTv1Client
+	calls    int32
+	complete int32
+}
+
+func (c *pollingClient) Result(ctx context.Context, reqID string, opts ...CallOption) (*msg.QueryResult, error) {
+	n := atomic.AddInt32(&c.calls, 1)
+	return &msg.QueryResult{
+		RequestId: reqID,
+		QueryStatus: &msg.QueryStatus{
+			Complete: c.complete > 0 && n >= c.complete,
+		},
+	}, nil
+}
+
+var testBackoff = Backoff{Initial: time.Millisecond, Max: 5 * time.Millisecond, Multiplier: 2}
+
+func TestWaitForResult(t *testing.T) {
+	ctx := context.Background()
+
+	client := &pollingClient{complete: 3}
+	result, err := WaitForResult(ctx, client, "abc", WithPollBackoff(testBackoff))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !IsComplete(result) || result.RequestId != "abc" {
+		t.Errorf("unexpected result: %v", result)
+	}
+
+	if client.calls != 3 {
+		t.Errorf("expected 3 calls, got %d", client.calls)
+	}
+
+	// max wait returns the partial result
+
+	client = &pollingClient{}
+	result, err = WaitForResult(ctx, client, "abc",
+		WithPollBackoff(testBackoff),
+		WithMaxWait(20*time.Millisecond),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result == nil || IsComplete(result) {
+		t.Errorf("expected incomplete result, got: %v", result)
+	}
+
+	// context cancellation
+
+	ctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+
+	if _, err = WaitForResult(ctx, &pollingClient{}, "abc", WithPollBackoff(testBackoff), WithMaxWait(0)); err != context.DeadlineExceeded {
+		t.Errorf("expected context.DeadlineExceeded, got: %v", err)
+	}
+}